@@ -1,19 +1,31 @@
 package main
 
 import (
+	"math"
 	"math/rand"
+	"unsafe"
 
+	"github.com/braheezy/bubblelife/life"
 	"github.com/go-gl/gl/v4.1-core/gl"
 	"github.com/go-gl/mathgl/mgl32"
 )
 
-// Bubble represents a 3D sphere (bubble) in the Game of Life.
+// Bubble represents a 3D sphere (bubble) showing one cell of the simulation in the life package.
 type Bubble struct {
 	Position mgl32.Vec3
-	// Current alive/dead state
+	// Coordinates of the cell this bubble shows
+	Cell life.Point
+	// Alive/dead state the bubble currently shows
 	CurrentState bool
-	// Next alive/dead state
+	// Alive/dead state of the cell in the simulation, which the bubble animates towards. Dying
+	// cells of Generations rules count as alive here
 	NextState bool
+	// Value of the cell in continuous worlds, which is how full the bubble grows. Cells of other
+	// worlds are always 1
+	Value float32
+	// How far a dying cell is on its way to death, from 0 (alive) to 1. Dying bubbles shrink and
+	// fade as it grows
+	Dying float32
 	// The radius for rendering (0 = dead, 1 = fully alive, other = transitioning)
 	Radius float32
 	// Is the bubble currently animating its radius
@@ -22,6 +34,9 @@ type Bubble struct {
 	Color mgl32.Vec3
 	// Group ID to distinguish clusters of alive bubbles
 	GroupID int
+	// Species of the cell under rules with several species, which gives the bubble its color.
+	// It is 0 under other rules, where the bubble takes the color of its group
+	Species int
 }
 
 var bubbleVAO, instanceVBO, instanceRadiusVBO, instanceColorVBO uint32
@@ -36,10 +51,43 @@ func NewBubble(position mgl32.Vec3) *Bubble {
 	return bubble
 }
 
+// targetRadius returns the radius the bubble animates towards. Dying bubbles shrink a step
+// with every dying state.
+func (bubble *Bubble) targetRadius() float32 {
+	if !bubble.NextState {
+		return 0.0
+	}
+	return bubble.Value * (1.0 - bubble.Dying*dyingShrink)
+}
+
+// shownColor returns the color the bubble is drawn with, which fades towards black as it dies.
+func (bubble *Bubble) shownColor() mgl32.Vec3 {
+	return bubble.Color.Mul(1.0 - bubble.Dying*dyingFade)
+}
+
+// dyingFraction returns how far a cell in the given state is on its way to death under a rule with
+// the given number of states. Alive and dead cells are at 0.
+func dyingFraction(state, states int) float32 {
+	if state < life.StateDying {
+		return 0.0
+	}
+	return float32(state-1) / float32(states-1)
+}
+
+// bubbleIndex finds the bubble showing a cell
+var bubbleIndex map[life.Point]*Bubble
+
 // initInstanceBuffer initializes the buffer for storing instance-specific data (bubble positions and colors).
+// The VAO and buffers are created on the first call. Later calls refill them, which lets the number of
+// bubbles grow and shrink.
 func initInstanceBuffer(bubbles []*Bubble) {
-	// Generate the VAO
-	gl.GenVertexArrays(1, &bubbleVAO)
+	// Generate the VAO and buffers once
+	if bubbleVAO == 0 {
+		gl.GenVertexArrays(1, &bubbleVAO)
+		gl.GenBuffers(1, &instanceVBO)
+		gl.GenBuffers(1, &instanceRadiusVBO)
+		gl.GenBuffers(1, &instanceColorVBO)
+	}
 	gl.BindVertexArray(bubbleVAO) // Bind the VAO
 
 	// Extract the positions, radii, and colors of the bubbles
@@ -50,33 +98,30 @@ func initInstanceBuffer(bubbles []*Bubble) {
 	for i, bubble := range bubbles {
 		positions[i] = bubble.Position
 		radii[i] = bubble.Radius
-		colors[i] = bubble.Color
+		colors[i] = bubble.shownColor()
 	}
 
-	// Generate and bind instance VBO for positions
-	gl.GenBuffers(1, &instanceVBO)
+	// Bind and fill instance VBO for positions
 	gl.BindBuffer(gl.ARRAY_BUFFER, instanceVBO)
-	gl.BufferData(gl.ARRAY_BUFFER, len(positions)*3*4, gl.Ptr(positions), gl.STATIC_DRAW)
+	gl.BufferData(gl.ARRAY_BUFFER, len(positions)*3*4, slicePtr(positions), gl.STATIC_DRAW)
 
 	// Enable instance attribute for position (Vec3)
 	gl.EnableVertexAttribArray(0)
 	gl.VertexAttribPointer(0, 3, gl.FLOAT, false, 3*4, gl.Ptr(nil))
 	gl.VertexAttribDivisor(0, 1) // Each instance uses a different position
 
-	// Generate and bind instance VBO for radii
-	gl.GenBuffers(1, &instanceRadiusVBO)
+	// Bind and fill instance VBO for radii
 	gl.BindBuffer(gl.ARRAY_BUFFER, instanceRadiusVBO)
-	gl.BufferData(gl.ARRAY_BUFFER, len(radii)*4, gl.Ptr(radii), gl.STATIC_DRAW)
+	gl.BufferData(gl.ARRAY_BUFFER, len(radii)*4, slicePtr(radii), gl.STATIC_DRAW)
 
 	// Enable instance attribute for radius (float)
 	gl.EnableVertexAttribArray(1)
 	gl.VertexAttribPointer(1, 1, gl.FLOAT, false, 1*4, gl.Ptr(nil))
 	gl.VertexAttribDivisor(1, 1)
 
-	// Generate and bind instance VBO for colors
-	gl.GenBuffers(1, &instanceColorVBO)
+	// Bind and fill instance VBO for colors
 	gl.BindBuffer(gl.ARRAY_BUFFER, instanceColorVBO)
-	gl.BufferData(gl.ARRAY_BUFFER, len(colors)*3*4, gl.Ptr(colors), gl.STATIC_DRAW)
+	gl.BufferData(gl.ARRAY_BUFFER, len(colors)*3*4, slicePtr(colors), gl.STATIC_DRAW)
 
 	// Enable instance attribute for color (Vec3)
 	gl.EnableVertexAttribArray(2)
@@ -97,7 +142,7 @@ func updateRadiiBuffer(bubbles []*Bubble) {
 
 	// Update instance VBO for radii (update the buffer on GPU)
 	gl.BindBuffer(gl.ARRAY_BUFFER, instanceRadiusVBO)
-	gl.BufferSubData(gl.ARRAY_BUFFER, 0, len(radii)*4, gl.Ptr(radii))
+	gl.BufferSubData(gl.ARRAY_BUFFER, 0, len(radii)*4, slicePtr(radii))
 }
 
 // updateColorBuffer updates the instance color buffer on the GPU.
@@ -105,12 +150,116 @@ func updateColorBuffer(bubbles []*Bubble) {
 	// Extract the updated colors of the bubbles
 	colors := make([]mgl32.Vec3, len(bubbles))
 	for i, bubble := range bubbles {
-		colors[i] = bubble.Color
+		colors[i] = bubble.shownColor()
 	}
 
 	// Update instance VBO for colors (update the buffer on GPU)
 	gl.BindBuffer(gl.ARRAY_BUFFER, instanceColorVBO)
-	gl.BufferSubData(gl.ARRAY_BUFFER, 0, len(colors)*3*4, gl.Ptr(colors))
+	gl.BufferSubData(gl.ARRAY_BUFFER, 0, len(colors)*3*4, slicePtr(colors))
+}
+
+// slicePtr returns a pointer to the first element of a slice for uploading to the GPU. Unlike
+// gl.Ptr, it accepts empty slices, which happen when the infinite universe dies out.
+func slicePtr[T any](data []T) unsafe.Pointer {
+	if len(data) == 0 {
+		return nil
+	}
+	return gl.Ptr(data)
+}
+
+// createSparseBubbles creates a fully grown bubble for every live cell of the infinite universe.
+func createSparseBubbles(world life.World, spacing float32) []*Bubble {
+	cells := world.LiveCells()
+	bubbles := make([]*Bubble, 0, len(cells))
+	bubbleIndex = make(map[life.Point]*Bubble, len(cells))
+	for _, cell := range cells {
+		bubble := newCellBubble(cell, spacing)
+		bubble.CurrentState = true
+		bubble.NextState = true
+		bubble.Radius = 1.0
+		bubble.Species = cellSpecies(world, cell)
+		bubbles = append(bubbles, bubble)
+	}
+
+	numGroups := findGroups(bubbles, 0, 0, spacing)
+	assignColorsToGroups(bubbles, numGroups)
+	return bubbles
+}
+
+// newCellBubble creates a dead bubble showing a cell of the world, placed where the lattice puts
+// the cell.
+func newCellBubble(cell life.Point, spacing float32) *Bubble {
+	position := lattice.Position(cell)
+	bubble := NewBubble(mgl32.Vec3{float32(position[0]) * spacing, float32(position[1]) * spacing, float32(position[2]) * spacing})
+	bubble.Cell = cell
+	bubble.Value = 1.0
+	bubbleIndex[cell] = bubble
+	return bubble
+}
+
+// syncBubbles points the bubbles at the current generation of the world, which they then animate
+// towards. Cells without a bubble yet, which only happens in the infinite universe, get a new bubble
+// that grows in. It reports whether bubbles were added, in which case the instance buffers need to be
+// refilled.
+func syncBubbles(world life.World, bubbles []*Bubble, spacing float32) ([]*Bubble, bool) {
+	if continuous, ok := world.(life.Continuous); ok {
+		// Cells of continuous worlds only come and go inside the pillar, which already has a bubble
+		// for every cell
+		for _, bubble := range bubbles {
+			bubble.Value = float32(continuous.Value(bubble.Cell))
+			bubble.NextState = bubble.Value > 0.0
+		}
+		return bubbles, false
+	}
+
+	states := world.Rule().States
+	for _, bubble := range bubbles {
+		state := world.State(bubble.Cell)
+		bubble.NextState = state != life.StateDead
+		bubble.Dying = dyingFraction(state, states)
+		if bubble.NextState {
+			// Dead bubbles keep the color they shrink away in
+			bubble.Species = cellSpecies(world, bubble.Cell)
+		}
+	}
+	added := false
+	for _, cell := range world.LiveCells() {
+		if _, ok := bubbleIndex[cell]; !ok {
+			bubble := newCellBubble(cell, spacing)
+			bubble.NextState = true
+			bubble.Species = cellSpecies(world, cell)
+			bubbles = append(bubbles, bubble)
+			added = true
+		}
+	}
+	return bubbles, added
+}
+
+// cellSpecies returns the species of a cell in worlds running a rule with several species, and 0
+// otherwise.
+func cellSpecies(world life.World, cell life.Point) int {
+	if multi, ok := world.(life.Multispecies); ok && world.Rule().Species > 1 {
+		return multi.Species(cell)
+	}
+	return 0
+}
+
+// pruneBubbles drops the bubbles of dead cells once they have shrunk away. It reports whether any
+// were dropped, in which case the instance buffers need to be refilled.
+func pruneBubbles(bubbles []*Bubble) ([]*Bubble, bool) {
+	kept := bubbles[:0]
+	for _, bubble := range bubbles {
+		if bubble.CurrentState || bubble.NextState || bubble.Radius > 0.0 {
+			kept = append(kept, bubble)
+		} else {
+			delete(bubbleIndex, bubble.Cell)
+		}
+	}
+	// Clear the dropped tail so the bubbles can be garbage collected
+	for i := len(kept); i < len(bubbles); i++ {
+		bubbles[i] = nil
+	}
+	return kept, len(kept) != len(bubbles)
 }
 
 // Render renders the bubble by binding its VAO and issuing a draw call.
@@ -133,21 +282,12 @@ func FindNeighbors(bubbles []*Bubble, index int, N, M int, spacing float32) []in
 	neighbors := []int{}
 	currentBubble := bubbles[index]
 
-	// Define the possible neighbor offsets in 3D (6 possible directions)
-	offsets := []mgl32.Vec3{
-		{spacing, 0, 0}, {-spacing, 0, 0}, // X-axis neighbors
-		{0, spacing, 0}, {0, -spacing, 0}, // Y-axis neighbors
-		{0, 0, spacing}, {0, 0, -spacing}, // Z-axis neighbors
-	}
-
-	// Iterate through bubbles to find those close enough to be neighbors
+	// Iterate through bubbles to find those close enough to be neighbors. Touching bubbles are one
+	// spacing apart on every lattice: 6 of them on the cubic one and 12 on the close-packed ones
 	for i, bubble := range bubbles {
 		if i != index && bubble.CurrentState {
-			for _, offset := range offsets {
-				if bubble.Position.ApproxEqualThreshold(currentBubble.Position.Add(offset), 0.01) {
-					neighbors = append(neighbors, i)
-					break
-				}
+			if distance := bubble.Position.Sub(currentBubble.Position).Len(); distance < spacing+0.01 {
+				neighbors = append(neighbors, i)
 			}
 		}
 	}
@@ -200,9 +340,12 @@ func assignColorsToGroups(bubbles []*Bubble, numGroups int) {
 		}
 	}
 
-	// Assign each bubble in a group a slightly varied color based on the base color
+	// Assign each bubble in a group a slightly varied color based on the base color. Bubbles of a
+	// species always have the species' color instead
 	for _, bubble := range bubbles {
-		if bubble.CurrentState {
+		if bubble.Species > 0 {
+			bubble.Color = speciesColor(bubble.Species, rule.Species)
+		} else if bubble.CurrentState {
 			baseColor := groupBaseColors[bubble.GroupID]
 			bubble.Color = mgl32.Vec3{
 				baseColor.X(), // Slight variation in R
@@ -211,4 +354,29 @@ func assignColorsToGroups(bubbles []*Bubble, numGroups int) {
 			}
 		}
 	}
+	paintVoxels()
+}
+
+// speciesColor returns the fixed color of a species out of the given number of species. The hues
+// are spread evenly around the color wheel, kept bright and pastel like the group colors.
+func speciesColor(species, count int) mgl32.Vec3 {
+	hue := float64(species-1) / float64(max(count, 1)) * 6.0
+	sector := int(hue) % 6
+	rise := float32(hue - math.Floor(hue))
+	const high, low = 0.95, 0.45
+	up, down := low+(high-low)*rise, high-(high-low)*rise
+	switch sector {
+	case 0:
+		return mgl32.Vec3{high, up, low}
+	case 1:
+		return mgl32.Vec3{down, high, low}
+	case 2:
+		return mgl32.Vec3{low, high, up}
+	case 3:
+		return mgl32.Vec3{low, down, high}
+	case 4:
+		return mgl32.Vec3{up, low, high}
+	default:
+		return mgl32.Vec3{high, low, down}
+	}
 }
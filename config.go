@@ -0,0 +1,312 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/braheezy/bubblelife/life"
+)
+
+// Config holds the scene settings that can be loaded from a JSON config file. Empty
+// fields keep their defaults.
+type Config struct {
+	Rule     string `json:"rule,omitempty"`
+	Boundary string `json:"boundary,omitempty"`
+	Seed     int64  `json:"seed,omitempty"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
+	// Depth is the same as Width when it isn't set
+	Depth           int     `json:"depth,omitempty"`
+	GenerationSpeed float64 `json:"generationSpeed,omitempty"`
+	Universe        string  `json:"universe,omitempty"`
+	Lenia           string  `json:"lenia,omitempty"`
+	Lattice         string  `json:"lattice,omitempty"`
+	OnStagnation    string  `json:"onStagnation,omitempty"`
+	Seeder          string  `json:"seeder,omitempty"`
+	// Pattern is a pattern library name or file, placed at PatternAt or in the middle
+	Pattern   string `json:"pattern,omitempty"`
+	PatternAt string `json:"patternAt,omitempty"`
+	// Vox is a MagicaVoxel model to start from, which sets the size of the pillar
+	Vox string `json:"vox,omitempty"`
+	// Infinite is shorthand for the infinite universe
+	Infinite bool `json:"infinite,omitempty"`
+}
+
+// loadConfig reads a JSON config file.
+func loadConfig(path string) (Config, error) {
+	var config Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("config %s: %w", path, err)
+	}
+	return config, nil
+}
+
+// parseSettings sets the scene settings from the config file and command line flags.
+// Flags given on the command line take precedence over the config file.
+func parseSettings(args []string) error {
+	flags := flag.NewFlagSet("bubblelife", flag.ContinueOnError)
+	readConfig := settingsFlags(flags)
+	flags.StringVar(&statsPath, "stats", "", "file to record the stats of every generation shown to")
+	flags.StringVar(&statsFormat, "stats-format", life.StatsCSV, "format of recorded and exported stats: csv or jsonl (one JSON object per line)")
+	flags.StringVar(&meshFormat, "mesh-format", meshGLB, "format F4 exports the live cells in: obj (with a .mtl file of colors), ply or glb (binary glTF 2.0)")
+	flags.StringVar(&meshShape, "mesh-shape", meshSpheres, "shapes F4 exports the live cells as: spheres (one per bubble) or cubes (merged into solids)")
+	loadPath := flags.String("load", "", "session file to bring back, with its settings, cells and camera. F5 and F9 save to and load from it (default "+sessionPath+")")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if statsFormat != life.StatsCSV && statsFormat != life.StatsJSONL {
+		return fmt.Errorf("unknown stats format %q, want %s or %s", statsFormat, life.StatsCSV, life.StatsJSONL)
+	}
+	if !slices.Contains(meshFormats, meshFormat) {
+		return fmt.Errorf("unknown mesh format %q, want one of %s", meshFormat, strings.Join(meshFormats, ", "))
+	}
+	if !slices.Contains(meshShapes, meshShape) {
+		return fmt.Errorf("unknown mesh shape %q, want %s", meshShape, strings.Join(meshShapes, " or "))
+	}
+	config, err := readConfig()
+	if err != nil {
+		return err
+	}
+	if *loadPath != "" {
+		s, err := readSessionFile(*loadPath)
+		if err != nil {
+			return err
+		}
+		// The session's settings win over any others, so the run comes back as it was
+		sessionPath, startSession = *loadPath, &s
+		config = s.settings.Config
+	}
+	return applyConfig(config)
+}
+
+// settingsFlags defines the flags of the scene settings on a flag set. The returned function
+// reads them, along with the config file they may name, once the flags are parsed.
+func settingsFlags(flags *flag.FlagSet) func() (Config, error) {
+	configPath := flags.String("config", "", "path to a JSON config file")
+	ruleFlag := flags.String("rule", life.DefaultRule.String(), "life rule in B/S notation (B5-7/S4-9) or Bays' notation (4555)")
+	boundaryFlag := flags.String("boundary", life.Torus.String(), "what lies past the pillar faces: periodic, dead, alive or reflect, or per axis like periodic,alive:dead,periodic")
+	seedFlag := flags.Int64("seed", initialSeed, "seed for the starting population")
+	widthFlag := flags.Int("width", pillarN, "pillar width in bubbles")
+	heightFlag := flags.Int("height", pillarM, "pillar height in bubbles")
+	depthFlag := flags.Int("depth", 0, "pillar depth in bubbles (default same as width)")
+	speedFlag := flags.Float64("speed", generationSpeed, "seconds between generations")
+	universeFlag := flags.String("universe", universe, "universe to run: pillar, packed (a bit per cell), infinite, hashlife (infinite, can skip far ahead) or lenia (continuous cells)")
+	leniaFlag := flags.String("lenia", life.DefaultLeniaParams.String(), "settings of the lenia universe, like mu=0.2,sigma=0.03,radius=3,dt=0.1")
+	latticeFlag := flags.String("lattice", life.Cubic.String(), "how the cells are arranged: cubic, fcc (face-centered cubic) or hcp (hexagonal close-packed)")
+	stagnationFlag := flags.String("on-stagnation", onStagnation, "what to do when the world dies out, freezes or oscillates: none, pause, reseed (start over with the next seed) or rule (switch to the next rule preset)")
+	seederFlag := flags.String("seeder", life.DefaultSeeder.String(), "pattern to start from: random, sphere, cube, noise, clusters, mirror or empty, with settings like sphere:radius=0.5,density=0.8")
+	patternFlag := flags.String("pattern", "", "pattern to place in the pillar: a name from the library ("+strings.Join(life.PatternNames(), ", ")+") or a "+life.PatternExt+" file. It brings its rule and starts from empty space unless -rule or -seeder say otherwise")
+	patternAtFlag := flags.String("pattern-at", "", "cell the pattern's corner is placed at, like 2,8,2 (default in the middle of the pillar)")
+	voxFlag := flags.String("vox", "", "MagicaVoxel .vox model whose voxels start alive. The pillar takes its size, and it starts from empty space unless -seeder says otherwise")
+	infiniteFlag := flags.Bool("infinite", false, "run in an unbounded universe instead of the pillar, same as -universe infinite")
+
+	return func() (Config, error) {
+		config := Config{
+			Rule:            *ruleFlag,
+			Boundary:        *boundaryFlag,
+			Seed:            *seedFlag,
+			Width:           *widthFlag,
+			Height:          *heightFlag,
+			Depth:           *depthFlag,
+			GenerationSpeed: *speedFlag,
+			Universe:        *universeFlag,
+			Lenia:           *leniaFlag,
+			Lattice:         *latticeFlag,
+			OnStagnation:    *stagnationFlag,
+			Seeder:          *seederFlag,
+			Pattern:         *patternFlag,
+			PatternAt:       *patternAtFlag,
+			Vox:             *voxFlag,
+			Infinite:        *infiniteFlag,
+		}
+		setFlags := map[string]bool{}
+		flags.Visit(func(f *flag.Flag) { setFlags[f.Name] = true })
+		// Patterns bring their own rule and start from empty space, so the defaults are left
+		// for applyConfig to pick
+		if !setFlags["rule"] {
+			config.Rule = ""
+		}
+		if !setFlags["seeder"] {
+			config.Seeder = ""
+		}
+		if *configPath != "" {
+			fileConfig, err := loadConfig(*configPath)
+			if err != nil {
+				return config, err
+			}
+			// Only take values from the file that weren't given on the command line
+			if fileConfig.Rule != "" && !setFlags["rule"] {
+				config.Rule = fileConfig.Rule
+			}
+			if fileConfig.Boundary != "" && !setFlags["boundary"] {
+				config.Boundary = fileConfig.Boundary
+			}
+			if fileConfig.Seed != 0 && !setFlags["seed"] {
+				config.Seed = fileConfig.Seed
+			}
+			if fileConfig.Width != 0 && !setFlags["width"] {
+				config.Width = fileConfig.Width
+			}
+			if fileConfig.Height != 0 && !setFlags["height"] {
+				config.Height = fileConfig.Height
+			}
+			if fileConfig.Depth != 0 && !setFlags["depth"] {
+				config.Depth = fileConfig.Depth
+			}
+			if fileConfig.GenerationSpeed != 0 && !setFlags["speed"] {
+				config.GenerationSpeed = fileConfig.GenerationSpeed
+			}
+			if fileConfig.Universe != "" && !setFlags["universe"] {
+				config.Universe = fileConfig.Universe
+			}
+			if fileConfig.Lenia != "" && !setFlags["lenia"] {
+				config.Lenia = fileConfig.Lenia
+			}
+			if fileConfig.Lattice != "" && !setFlags["lattice"] {
+				config.Lattice = fileConfig.Lattice
+			}
+			if fileConfig.OnStagnation != "" && !setFlags["on-stagnation"] {
+				config.OnStagnation = fileConfig.OnStagnation
+			}
+			if fileConfig.Seeder != "" && !setFlags["seeder"] {
+				config.Seeder = fileConfig.Seeder
+			}
+			if fileConfig.Pattern != "" && !setFlags["pattern"] {
+				config.Pattern = fileConfig.Pattern
+			}
+			if fileConfig.PatternAt != "" && !setFlags["pattern-at"] {
+				config.PatternAt = fileConfig.PatternAt
+			}
+			if fileConfig.Vox != "" && !setFlags["vox"] {
+				config.Vox = fileConfig.Vox
+			}
+			if fileConfig.Infinite && !setFlags["infinite"] && !setFlags["universe"] {
+				config.Infinite = true
+			}
+		}
+		return config, nil
+	}
+}
+
+// applyConfig validates the config and copies it into the scene and UI settings.
+func applyConfig(config Config) error {
+	var p *life.Pattern
+	if config.Pattern != "" {
+		loaded, err := loadPattern(config.Pattern)
+		if err != nil {
+			return err
+		}
+		p = &loaded
+	}
+	at, err := parsePatternAt(config.PatternAt)
+	if err != nil {
+		return err
+	}
+	if config.Rule == "" {
+		config.Rule = life.DefaultRule.String()
+		if p != nil && p.Rule != "" {
+			config.Rule = p.Rule
+		}
+	}
+	var v *life.Vox
+	if config.Vox != "" {
+		if v, err = loadVox(config.Vox); err != nil {
+			return err
+		}
+		// The pillar is at least 2 cells wide and high, so flat models lie in a bigger one
+		config.Width, config.Height, config.Depth = max(2, v.Size.X), max(2, v.Size.Y), v.Size.Z
+	}
+	if config.Seeder == "" && (p != nil || v != nil) {
+		config.Seeder = life.EmptySeeder.String()
+	}
+	r, err := life.ParseRule(config.Rule)
+	if err != nil {
+		return err
+	}
+	if config.Infinite {
+		config.Universe = universeInfinite
+	}
+	if !slices.Contains(universes, config.Universe) {
+		return fmt.Errorf("unknown universe %q, want one of %s", config.Universe, strings.Join(universes, ", "))
+	}
+	if !slices.Contains(stagnationActions, config.OnStagnation) {
+		return fmt.Errorf("unknown stagnation action %q, want one of %s", config.OnStagnation, strings.Join(stagnationActions, ", "))
+	}
+	l, err := life.ParseLattice(config.Lattice)
+	if err != nil {
+		return err
+	}
+	if err := checkUniverse(config.Universe, r, l); err != nil {
+		return err
+	}
+	if err := checkStagnation(config.OnStagnation, config.Universe); err != nil {
+		return err
+	}
+	b, err := life.ParseBoundary(config.Boundary)
+	if err != nil {
+		return err
+	}
+	lp, err := life.ParseLeniaParams(config.Lenia)
+	if err != nil {
+		return err
+	}
+	sd, err := life.ParseSeeder(config.Seeder)
+	if err != nil {
+		return err
+	}
+	if config.Depth == 0 {
+		config.Depth = config.Width
+	}
+	if config.Width < 2 || config.Height < 2 || config.Depth < 1 {
+		return fmt.Errorf("pillar must be at least 2x2x1, got %dx%dx%d", config.Width, config.Height, config.Depth)
+	}
+	if config.Seed < 1 {
+		return fmt.Errorf("seed must be positive, got %d", config.Seed)
+	}
+	if config.GenerationSpeed < 0 {
+		return fmt.Errorf("generation speed can't be negative, got %.2f", config.GenerationSpeed)
+	}
+
+	rule = r
+	boundary = b
+	leniaParams = lp
+	seeder = sd
+	pattern, patternAt = p, at
+	voxModel = v
+	lattice = l
+	initialSeed, uiSeed = config.Seed, config.Seed
+	pillarN, uiN = config.Width, config.Width
+	pillarM, uiM = config.Height, config.Height
+	pillarK, uiK = config.Depth, config.Depth
+	generationSpeed, uiGenerationSpeed = config.GenerationSpeed, config.GenerationSpeed
+	universe = config.Universe
+	onStagnation = config.OnStagnation
+	return nil
+}
+
+// currentConfig returns the settings of the scene shown, which applyConfig turns back into the
+// same scene. The pattern and model it started from aren't part of them.
+func currentConfig() Config {
+	return Config{
+		Rule:            rule.String(),
+		Boundary:        boundary.String(),
+		Seed:            uiSeed,
+		Width:           pillarN,
+		Height:          pillarM,
+		Depth:           pillarK,
+		GenerationSpeed: generationSpeed,
+		Universe:        universe,
+		Lenia:           leniaParams.String(),
+		Lattice:         lattice.String(),
+		OnStagnation:    onStagnation,
+		Seeder:          seeder.String(),
+	}
+}
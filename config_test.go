@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func TestApplyConfigStagnation(t *testing.T) {
+	// Lenia has no rules to switch to, so settling would fail every time
+	err := applyConfig(Config{Universe: universeLenia, OnStagnation: stagnationRule})
+	if want := "the lenia universe can't switch rules when it settles"; err == nil || err.Error() != want {
+		t.Errorf("got error %v, want %q", err, want)
+	}
+
+	previous := universe
+	universe = universeLenia
+	defer func() { universe = previous }()
+	if next := nextStagnationAction(stagnationReseed, 1); next != stagnationNone {
+		t.Errorf("in the lenia universe the action after reseed is %s, want none", next)
+	}
+	if next := nextStagnationAction(stagnationNone, -1); next != stagnationReseed {
+		t.Errorf("in the lenia universe the action before none is %s, want reseed", next)
+	}
+}
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/braheezy/bubblelife/life"
+)
+
+// Ways the explorer picks the rules to try when none are given
+const (
+	exploreRandom = "random"
+	exploreRanges = "ranges"
+	// share of the cells changing each generation that scores best
+	exploreActivity = 0.1
+)
+
+// exploreRun is how lively a rule was when run from one seed.
+type exploreRun struct {
+	// variance of the share of cells that are alive
+	variance float64
+	// average share of cells alive, and born or dying each generation
+	density  float64
+	activity float64
+	// generation the world died out or started repeating, or the number of generations run if it
+	// never did
+	stagnation int
+	settled    bool
+	// average number of generations a cluster of touching cells lived
+	clusterLifetime float64
+}
+
+// exploreResult is how lively a rule was over all seeds.
+type exploreResult struct {
+	rule  life.Rule
+	runs  []exploreRun
+	score float64
+}
+
+// runExplore runs many rules from many seeds on the pillar for `bubblelife explore` and writes a
+// report of them, ranked by how lively they are. Rules can be given as arguments, otherwise they
+// are picked at random or every rule of ranges of neighbor counts is tried. It takes the same
+// settings as the window, whose rule sets the neighborhood, states and species of the rules
+// tried.
+func runExplore(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("bubblelife explore", flag.ContinueOnError)
+	readConfig := settingsFlags(flags)
+	mode := flags.String("rules", exploreRandom, "rules to try when none are given as arguments: random (birth and survival ranges) or ranges (every range within -span)")
+	count := flags.Int("count", 50, "number of random rules to try")
+	span := flags.String("span", "4-8", "neighbor counts every range rule's birth and survival ranges lie in")
+	seeds := flags.Int("seeds", 5, "number of seeds to run each rule from, counting up from -seed")
+	generations := flags.Int("generations", 200, "number of generations to run each seed")
+	top := flags.Int("top", 20, "number of rules to report, 0 for all")
+	outPath := flags.String("out", "", "file to write the report to instead of standard output")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	config, err := readConfig()
+	if err != nil {
+		return err
+	}
+	if err := applyConfig(config); err != nil {
+		return err
+	}
+	if universe != universePillar && universe != universePacked {
+		return fmt.Errorf("explore runs in the pillar or packed universe, not %s", universe)
+	}
+	if *seeds < 1 || *generations < 1 {
+		return fmt.Errorf("need at least 1 seed and 1 generation, got %d and %d", *seeds, *generations)
+	}
+	// Patterns are checked once here rather than in every run
+	size := life.Size{X: pillarN, Y: pillarM, Z: pillarK}
+	if err := placePattern(life.NewGrid(size, rule, boundary), size); err != nil {
+		return err
+	}
+
+	var rules []life.Rule
+	switch {
+	case flags.NArg() > 0:
+		for _, arg := range flags.Args() {
+			r, err := life.ParseRule(arg)
+			if err != nil {
+				return err
+			}
+			rules = append(rules, r)
+		}
+	case *mode == exploreRandom:
+		rules = randomRules(rule, *count, initialSeed)
+	case *mode == exploreRanges:
+		lo, hi, err := parseSpan(*span)
+		if err != nil {
+			return err
+		}
+		if rules, err = rangeRules(rule, lo, hi); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown way to pick rules %q, want %s or %s", *mode, exploreRandom, exploreRanges)
+	}
+
+	results := exploreRules(rules, *seeds, *generations)
+	if *top > 0 && len(results) > *top {
+		results = results[:*top]
+	}
+
+	if *outPath != "" {
+		file, err := os.Create(*outPath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if err := writeExploreReport(file, results, len(rules), *seeds, *generations); err != nil {
+			return err
+		}
+		return file.Close()
+	}
+	return writeExploreReport(out, results, len(rules), *seeds, *generations)
+}
+
+// parseSpan parses a range of neighbor counts like "4-8".
+func parseSpan(s string) (lo, hi int, err error) {
+	loText, hiText, _ := strings.Cut(s, "-")
+	lo, err = strconv.Atoi(loText)
+	if err == nil {
+		hi, err = strconv.Atoi(hiText)
+	}
+	if err != nil || lo < 0 || hi < lo {
+		return 0, 0, fmt.Errorf("span %q must be two neighbor counts like 4-8", s)
+	}
+	return lo, hi, nil
+}
+
+// rangeRule returns a rule with a single birth and survival range that is otherwise like base.
+func rangeRule(base life.Rule, b0, b1, s0, s1 int) (life.Rule, error) {
+	r, err := life.ParseRule(fmt.Sprintf("B%d-%d/S%d-%d/%s", b0, b1, s0, s1, base.Neighborhood))
+	if err != nil {
+		return r, err
+	}
+	r.States, r.Species = base.States, base.Species
+	r.BirthChance, r.SurvivalChance, r.Noise = base.BirthChance, base.SurvivalChance, base.Noise
+	return r, nil
+}
+
+// randomRules picks count different rules with a birth range of up to 4 counts and a survival
+// range of up to 7, the shape of the well known 3D rules. Births need at least one neighbor.
+func randomRules(base life.Rule, count int, seed int64) []life.Rule {
+	neighbors := lattice.Neighbors(base.Neighborhood)
+	rnd := rand.New(rand.NewSource(seed))
+	seen := make(map[string]bool)
+	var rules []life.Rule
+	// Small neighborhoods don't have that many rules, so give up after enough repeats
+	for tries := 0; len(rules) < count && tries < 100*count; tries++ {
+		b0 := 1 + rnd.Intn(max(neighbors/2, 1))
+		b1 := min(b0+rnd.Intn(4), neighbors)
+		s0 := rnd.Intn(neighbors/2 + 1)
+		s1 := min(s0+rnd.Intn(7), neighbors)
+		r, err := rangeRule(base, b0, b1, s0, s1)
+		if err != nil || seen[r.String()] {
+			continue
+		}
+		seen[r.String()] = true
+		rules = append(rules, r)
+	}
+	return rules
+}
+
+// rangeRules returns every rule whose birth and survival ranges both lie within lo to hi.
+func rangeRules(base life.Rule, lo, hi int) ([]life.Rule, error) {
+	if neighbors := lattice.Neighbors(base.Neighborhood); hi > neighbors {
+		return nil, fmt.Errorf("span goes up to %d, but cells only have %d neighbors", hi, neighbors)
+	}
+	var rules []life.Rule
+	for b0 := lo; b0 <= hi; b0++ {
+		for b1 := b0; b1 <= hi; b1++ {
+			for s0 := lo; s0 <= hi; s0++ {
+				for s1 := s0; s1 <= hi; s1++ {
+					r, err := rangeRule(base, b0, b1, s0, s1)
+					if err != nil {
+						return nil, err
+					}
+					rules = append(rules, r)
+				}
+			}
+		}
+	}
+	return rules, nil
+}
+
+// exploreRules runs every rule from each seed, spread over a goroutine per CPU, and returns them
+// from the liveliest down.
+func exploreRules(rules []life.Rule, seeds, generations int) []exploreResult {
+	results := make([]exploreResult, len(rules))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range runtime.GOMAXPROCS(0) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i].rule = rules[i]
+				for seed := initialSeed; seed < initialSeed+int64(seeds); seed++ {
+					results[i].runs = append(results[i].runs, exploreRule(rules[i], seed, generations))
+				}
+				results[i].score = exploreScore(results[i].runs, generations)
+			}
+		}()
+	}
+	for i := range rules {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	// Equal scores keep the order the rules were given in, so reports are the same every time
+	sort.SliceStable(results, func(i, j int) bool { return results[i].score > results[j].score })
+	return results
+}
+
+// exploreRule runs a rule on the pillar from one seed and measures how lively it was.
+func exploreRule(r life.Rule, seed int64, generations int) exploreRun {
+	// The package level settings are shared between the goroutines, so they are only read
+	size := life.Size{X: pillarN, Y: pillarM, Z: pillarK}
+	var w life.World
+	if universe == universePacked {
+		g := life.NewBitGrid(size, r, boundary)
+		g.SetLattice(lattice)
+		g.SetSeed(seed)
+		g.SetWorkers(1)
+		w = g
+	} else {
+		g := life.NewGrid(size, r, boundary)
+		g.SetLattice(lattice)
+		g.SetSeed(seed)
+		g.SetWorkers(1)
+		w = g
+	}
+	// runExplore made sure the pattern fits
+	seedWorld(w, size, seed)
+	life.FillRandomSpecies(w.(life.Multispecies), seed)
+	voxSpecies(w.(life.Multispecies))
+
+	cells := float64(size.Cells())
+	detector := life.NewDetector(maxDetectedPeriod)
+	var clusters clusterTracker
+	var sum, sumSquares, changes float64
+	run := exploreRun{stagnation: generations}
+	for {
+		population, births, deaths := clusters.track(w)
+		density := float64(population) / cells
+		sum += density
+		sumSquares += density * density
+		changes += float64(births+deaths) / cells
+		if verdict := detector.Observe(w); verdict.Settled() {
+			run.stagnation, run.settled = verdict.Since, true
+			break
+		}
+		if w.Generation() >= generations {
+			break
+		}
+		w.Step()
+	}
+
+	// Settled worlds would stay as they are, so the generations left count as they ended
+	counted := float64(w.Generation() + 1)
+	left := float64(generations - w.Generation())
+	last := float64(w.Population()) / cells
+	sum += left * last
+	sumSquares += left * last * last
+	total := counted + left
+	run.density = sum / total
+	run.variance = max(sumSquares/total-run.density*run.density, 0)
+	run.activity = changes / total
+	run.clusterLifetime = clusters.averageLifetime(w.Generation())
+	return run
+}
+
+// exploreScore rates how lively the runs of a rule were, from 0 up. Lively pillars keep going
+// without settling, neither empty out nor fill up, have a population that swings, grow clusters
+// that last a while, and change about a tenth of their cells each generation: quieter pillars
+// are dull and busier ones are noise. Each of these scales the score.
+func exploreScore(runs []exploreRun, generations int) float64 {
+	var score float64
+	for _, run := range runs {
+		liveliness := float64(run.stagnation) / float64(generations)
+		balance := 1 - math.Abs(2*run.density-1)
+		swing := 1.0
+		if run.density > 0 {
+			swing += min(math.Sqrt(run.variance)/run.density, 1)
+		}
+		activity := run.activity / exploreActivity * math.Exp(1-run.activity/exploreActivity)
+		score += liveliness * balance * swing * activity * math.Log1p(run.clusterLifetime)
+	}
+	return 100 * score / float64(len(runs))
+}
+
+// clusterTracker follows clusters of touching live cells from one generation to the next. A
+// cluster lives on in the groups of the next generation that share a cell with it. When
+// clusters merge the oldest lives on, and when one splits the first part found keeps it.
+type clusterTracker struct {
+	// cluster of every live cell of the last generation, and the generation each was born and
+	// the most cells it had
+	cluster map[life.Point]int
+	born    []int
+	largest []int
+	// generations lived by the clusters that have ended, each counted once for every cell it had
+	// at its largest, and the number of cells counted
+	lifetimes, cells int
+}
+
+// track follows the clusters into the current generation of the world. It returns the number of
+// live cells and how many were born and died since the last generation tracked.
+func (c *clusterTracker) track(w life.World) (population, births, deaths int) {
+	generation := w.Generation()
+	next := make(map[life.Point]int)
+	alive := make(map[int]bool)
+	for _, group := range life.GroupCells(w) {
+		id := -1
+		for _, p := range group {
+			if parent, ok := c.cluster[p]; ok && !alive[parent] && (id < 0 || c.born[parent] < c.born[id]) {
+				id = parent
+			}
+		}
+		if id < 0 {
+			id = len(c.born)
+			c.born = append(c.born, generation)
+			c.largest = append(c.largest, 0)
+		}
+		alive[id] = true
+		c.largest[id] = max(c.largest[id], len(group))
+		for _, p := range group {
+			next[p] = id
+			if _, ok := c.cluster[p]; !ok && c.cluster != nil {
+				births++
+			}
+		}
+	}
+
+	// Clusters of the last generation that didn't live on ended just now
+	for p, id := range c.cluster {
+		if _, ok := next[p]; !ok {
+			deaths++
+		}
+		if !alive[id] {
+			alive[id] = true
+			c.lifetimes += (generation - c.born[id]) * c.largest[id]
+			c.cells += c.largest[id]
+		}
+	}
+	c.cluster = next
+	return len(next), births, deaths
+}
+
+// averageLifetime returns how many generations the clusters lived on average, counting the
+// ones still alive at the given last generation as if they ended after it. Clusters count in
+// proportion to their size, so the specks that flicker in and out of a busy pillar don't drown
+// out the structures that last.
+func (c *clusterTracker) averageLifetime(generation int) float64 {
+	lifetimes, cells := c.lifetimes, c.cells
+	counted := make(map[int]bool)
+	for _, id := range c.cluster {
+		if !counted[id] {
+			counted[id] = true
+			lifetimes += (generation + 1 - c.born[id]) * c.largest[id]
+			cells += c.largest[id]
+		}
+	}
+	if cells == 0 {
+		return 0
+	}
+	return float64(lifetimes) / float64(cells)
+}
+
+// writeExploreReport writes the ranked rules as a table, averaging each measure over the seeds.
+func writeExploreReport(out io.Writer, results []exploreResult, rules, seeds, generations int) error {
+	fmt.Fprintf(out, "%d rules, %d seeds each, %d generations on a %dx%dx%d %s pillar\n\n",
+		rules, seeds, generations, pillarN, pillarM, pillarK, lattice)
+	table := tabwriter.NewWriter(out, 0, 8, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(table, "rank\trule\tscore\tdensity\tvariance\tactivity\tstagnation\tsettled\tcluster life\t")
+	for i, result := range results {
+		var density, variance, activity, stagnation, lifetime float64
+		settled := 0
+		for _, run := range result.runs {
+			density += run.density
+			variance += run.variance
+			activity += run.activity
+			stagnation += float64(run.stagnation)
+			lifetime += run.clusterLifetime
+			if run.settled {
+				settled++
+			}
+		}
+		n := float64(len(result.runs))
+		fmt.Fprintf(table, "%d\t%s\t%.2f\t%.3f\t%.5f\t%.3f\t%.0f\t%d/%d\t%.1f\t\n",
+			i+1, result.rule, result.score, density/n, variance/n, activity/n, stagnation/n, settled, len(result.runs), lifetime/n)
+	}
+	return table.Flush()
+}
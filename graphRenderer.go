@@ -0,0 +1,78 @@
+package main
+
+import (
+	"unsafe"
+
+	"github.com/go-gl/gl/v4.1-core/gl"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// A renderer for flat shapes drawn over the scene in window coordinates, like the text of the
+// TextRenderer. The overlay uses it to chart the recorded stats.
+type GraphRenderer struct {
+	shader   *Shader
+	VAO, VBO uint32
+}
+
+func NewGraphRenderer(width, height int) *GraphRenderer {
+	gr := GraphRenderer{}
+	// load and configure shader
+	gr.shader, _ = NewShader("shaders/graph_2d.vs", "shaders/graph_2d.fs", "")
+	gr.shader.use()
+	gr.shader.setMat4("projection", mgl32.Ortho2D(0.0, float32(width), float32(height), 0.0))
+	// configure VAO/VBO for points that are uploaded every draw
+	gl.GenVertexArrays(1, &gr.VAO)
+	gl.GenBuffers(1, &gr.VBO)
+	gl.BindVertexArray(gr.VAO)
+	gl.BindBuffer(gl.ARRAY_BUFFER, gr.VBO)
+	gl.EnableVertexAttribArray(0)
+	gl.VertexAttribPointer(0, 2, gl.FLOAT, false, 2*int32(unsafe.Sizeof(float32(0))), gl.Ptr(nil))
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+	gl.BindVertexArray(0)
+
+	return &gr
+}
+
+// RenderRect fills the rectangle with its top left corner at x, y with a see-through color.
+func (gr *GraphRenderer) RenderRect(x, y, w, h float32, color mgl32.Vec3, alpha float32) {
+	vertices := []float32{
+		x, y + h,
+		x + w, y,
+		x, y,
+
+		x, y + h,
+		x + w, y + h,
+		x + w, y,
+	}
+	gr.draw(gl.TRIANGLES, vertices, color, alpha)
+}
+
+// RenderLine draws a line through values over the rectangle with its top left corner at x, y.
+// The values are spread across the width one step apart, and scaled so top reaches the top of
+// the rectangle and 0 its bottom.
+func (gr *GraphRenderer) RenderLine(values []float32, top, x, y, w, h, step float32, color mgl32.Vec3) {
+	if len(values) < 2 || top <= 0 {
+		return
+	}
+	vertices := make([]float32, 0, 2*len(values))
+	for i, v := range values {
+		vertices = append(vertices, x+float32(i)*step, y+h-min(v/top, 1)*h)
+	}
+	gr.draw(gl.LINE_STRIP, vertices, color, 1.0)
+}
+
+// draw uploads the vertices and draws them in one color.
+func (gr *GraphRenderer) draw(mode uint32, vertices []float32, color mgl32.Vec3, alpha float32) {
+	// Overlays go over the bubbles however close they are
+	gl.Disable(gl.DEPTH_TEST)
+	gr.shader.use()
+	gr.shader.setVec3("lineColor", color)
+	gr.shader.setFloat("alpha", alpha)
+	gl.BindVertexArray(gr.VAO)
+	gl.BindBuffer(gl.ARRAY_BUFFER, gr.VBO)
+	gl.BufferData(gl.ARRAY_BUFFER, len(vertices)*int(unsafe.Sizeof(vertices[0])), gl.Ptr(vertices), gl.DYNAMIC_DRAW)
+	gl.DrawArrays(mode, 0, int32(len(vertices)/2))
+	gl.BindBuffer(gl.ARRAY_BUFFER, 0)
+	gl.BindVertexArray(0)
+	gl.Enable(gl.DEPTH_TEST)
+}
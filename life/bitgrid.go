@@ -0,0 +1,543 @@
+package life
+
+import (
+	"fmt"
+	"math/bits"
+	"runtime"
+	"sync"
+)
+
+// BitGrid is a bounded world like Grid that packs cells into the bits of uint64 words. Each
+// row of cells along the z axis is a run of words, and neighbor counts are summed for 64
+// cells at a time with bit-sliced adders, in the style of fast 2D life engines.
+type BitGrid struct {
+	size     Size
+	rule     Rule
+	boundary Boundary
+	lattice  Lattice
+	// words per row and the bits of the last word that hold cells
+	rowWords int
+	lastMask uint64
+	// neighbor offsets of each class of row of the lattice, grouped by their x and y offset so
+	// each source row is looked up once
+	columns [][]offsetColumn
+	// width of the bit-sliced neighbor counters
+	counterBits int
+	// cells holds the current generation and next is filled in while stepping
+	cells []uint64
+	next  []uint64
+	// For Generations rules, dying marks the cells in a dying state like cells marks the live
+	// ones, and ages holds the dying state of every cell, only meaningful where dying is set
+	dying     []uint64
+	nextDying []uint64
+	ages      []uint8
+	// For rules with several species, the species of every live and dying cell. Cells are only
+	// written when they are born, which they can't be while a neighbor reads them, so one buffer
+	// is enough
+	species []uint8
+	// seed of the dice of stochastic rules
+	seed       int64
+	generation int
+	// how many goroutines Step splits the grid across
+	workers int
+}
+
+// offsetColumn holds the z offsets of the neighbors that share an x and y offset.
+type offsetColumn struct {
+	dx, dy int
+	dz     []int
+}
+
+// NewBitGrid creates an empty bit-packed grid. It panics if any side of the box is smaller
+// than one cell.
+func NewBitGrid(size Size, rule Rule, boundary Boundary) *BitGrid {
+	if size.X < 1 || size.Y < 1 || size.Z < 1 {
+		panic(fmt.Sprintf("life: grid size %dx%dx%d must be at least 1x1x1", size.X, size.Y, size.Z))
+	}
+	rowWords := (size.Z + 63) / 64
+	g := &BitGrid{
+		size:      size,
+		boundary:  boundary,
+		rowWords:  rowWords,
+		lastMask:  ^uint64(0) >> (rowWords*64 - size.Z),
+		cells:     make([]uint64, size.X*size.Y*rowWords),
+		next:      make([]uint64, size.X*size.Y*rowWords),
+		dying:     make([]uint64, size.X*size.Y*rowWords),
+		nextDying: make([]uint64, size.X*size.Y*rowWords),
+		workers:   runtime.GOMAXPROCS(0),
+	}
+	g.SetRule(rule)
+	return g
+}
+
+// Size returns the size of the grid's box.
+func (g *BitGrid) Size() Size {
+	return g.size
+}
+
+// Contains reports whether p lies inside the grid's box.
+func (g *BitGrid) Contains(p Point) bool {
+	return p.X >= 0 && p.X < g.size.X && p.Y >= 0 && p.Y < g.size.Y && p.Z >= 0 && p.Z < g.size.Z
+}
+
+// row returns the words holding the row of cells at x, y.
+func (g *BitGrid) row(cells []uint64, x, y int) []uint64 {
+	start := (x*g.size.Y + y) * g.rowWords
+	return cells[start : start+g.rowWords]
+}
+
+// Generation returns how many generations the grid has advanced.
+func (g *BitGrid) Generation() int {
+	return g.generation
+}
+
+// Alive reports whether the cell at p is alive. Cells outside the box are dead.
+func (g *BitGrid) Alive(p Point) bool {
+	if !g.Contains(p) {
+		return false
+	}
+	return g.row(g.cells, p.X, p.Y)[p.Z/64]&(1<<(p.Z%64)) != 0
+}
+
+// State returns the state of the cell at p. Cells outside the box are dead.
+func (g *BitGrid) State(p Point) int {
+	switch {
+	case g.Alive(p):
+		return StateAlive
+	case g.Contains(p) && g.row(g.dying, p.X, p.Y)[p.Z/64]&(1<<(p.Z%64)) != 0:
+		return int(g.ages[g.index(p)])
+	default:
+		return StateDead
+	}
+}
+
+// Set makes the cell at p alive or dead. Cells outside the box are ignored.
+func (g *BitGrid) Set(p Point, alive bool) {
+	if !g.Contains(p) {
+		return
+	}
+	row := g.row(g.cells, p.X, p.Y)
+	if alive {
+		row[p.Z/64] |= 1 << (p.Z % 64)
+		if g.species != nil {
+			g.species[g.index(p)] = 1
+		}
+	} else {
+		row[p.Z/64] &^= 1 << (p.Z % 64)
+	}
+	g.row(g.dying, p.X, p.Y)[p.Z/64] &^= 1 << (p.Z % 64)
+}
+
+// index returns where the age and species of the cell at p are stored.
+func (g *BitGrid) index(p Point) int {
+	return (p.X*g.size.Y+p.Y)*g.size.Z + p.Z
+}
+
+// Species returns the species of the live or dying cell at p, and 0 for dead cells.
+func (g *BitGrid) Species(p Point) int {
+	switch {
+	case g.State(p) == StateDead:
+		return 0
+	case g.rule.Species <= 1:
+		return 1
+	default:
+		return int(g.species[g.index(p)])
+	}
+}
+
+// SetSpecies makes the cell at p alive as a member of the given species. Cells outside the box
+// and species the rule doesn't have are ignored.
+func (g *BitGrid) SetSpecies(p Point, species int) {
+	if !g.Contains(p) || !validSpecies(g.rule, species) {
+		return
+	}
+	g.Set(p, true)
+	if g.species != nil {
+		g.species[g.index(p)] = uint8(species)
+	}
+}
+
+// Population returns the number of live cells.
+func (g *BitGrid) Population() int {
+	population := 0
+	for _, word := range g.cells {
+		population += bits.OnesCount64(word)
+	}
+	return population
+}
+
+// LiveCells returns the coordinates of every live cell, ordered by x, then y, then z. Only
+// the set bits are visited, so empty stretches of the grid cost one word per 64 cells.
+func (g *BitGrid) LiveCells() []Point {
+	var points []Point
+	for x := 0; x < g.size.X; x++ {
+		for y := 0; y < g.size.Y; y++ {
+			for i, word := range g.row(g.cells, x, y) {
+				for word != 0 {
+					z := i*64 + bits.TrailingZeros64(word)
+					points = append(points, Point{x, y, z})
+					word &= word - 1
+				}
+			}
+		}
+	}
+	return points
+}
+
+// Rule returns the rule the grid runs.
+func (g *BitGrid) Rule() Rule {
+	return g.rule
+}
+
+// SetRule changes the rule used for the following generations. Every rule can run on a grid.
+func (g *BitGrid) SetRule(r Rule) error {
+	if r.Species > 1 && g.rule.Species <= 1 {
+		// Every cell alive so far is of the first species
+		if g.species == nil {
+			g.species = make([]uint8, g.size.Cells())
+		}
+		for i := range g.species {
+			g.species[i] = 1
+		}
+	} else if r.Species < g.rule.Species {
+		// Cells of species the rule no longer has join the ones it does
+		for i, species := range g.species {
+			g.species[i] = foldSpecies(species, r)
+		}
+	}
+	g.rule = r
+	g.setNeighbors()
+
+	if r.States > 2 && g.ages == nil {
+		g.ages = make([]uint8, g.size.Cells())
+	}
+	if r.States <= 2 {
+		// Two state rules have no dying cells
+		clear(g.dying)
+	}
+	return nil
+}
+
+// Seed returns the seed the grid rolls the dice of stochastic rules from.
+func (g *BitGrid) Seed() int64 {
+	return g.seed
+}
+
+// SetSeed changes the seed the grid rolls the dice of stochastic rules from.
+func (g *BitGrid) SetSeed(seed int64) {
+	g.seed = seed
+}
+
+// Lattice returns how the grid's cells are arranged.
+func (g *BitGrid) Lattice() Lattice {
+	return g.lattice
+}
+
+// SetLattice changes how the grid's cells are arranged for the following generations, like
+// Grid.SetLattice.
+func (g *BitGrid) SetLattice(l Lattice) error {
+	g.lattice = l
+	g.setNeighbors()
+	return nil
+}
+
+// setNeighbors groups the neighbor offsets for the rule and lattice into columns.
+func (g *BitGrid) setNeighbors() {
+	classes := g.lattice.offsets(g.rule.Neighborhood)
+	g.columns = make([][]offsetColumn, len(classes))
+	largest := 0
+	for class, offsets := range classes {
+		index := map[[2]int]int{}
+		for _, offset := range offsets {
+			key := [2]int{offset[0], offset[1]}
+			i, ok := index[key]
+			if !ok {
+				i = len(g.columns[class])
+				index[key] = i
+				g.columns[class] = append(g.columns[class], offsetColumn{dx: offset[0], dy: offset[1]})
+			}
+			g.columns[class][i].dz = append(g.columns[class][i].dz, offset[2])
+		}
+		largest = max(largest, len(offsets))
+	}
+	g.counterBits = bits.Len(uint(largest))
+}
+
+// Boundary returns what lies past the faces of the grid.
+func (g *BitGrid) Boundary() Boundary {
+	return g.boundary
+}
+
+// SetBoundary changes what lies past the faces of the grid for the following generations.
+func (g *BitGrid) SetBoundary(b Boundary) {
+	g.boundary = b
+}
+
+// Workers returns how many goroutines Step splits the grid across.
+func (g *BitGrid) Workers() int {
+	return g.workers
+}
+
+// SetWorkers sets how many goroutines Step splits the grid across, like Grid.SetWorkers.
+func (g *BitGrid) SetWorkers(n int) {
+	if n < 1 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	g.workers = n
+}
+
+// Step advances the grid one generation, in parallel slabs along the x axis like Grid.Step.
+func (g *BitGrid) Step() {
+	workers := min(g.workers, g.size.X)
+	if workers <= 1 {
+		g.stepSlab(0, g.size.X)
+	} else {
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			x0, x1 := g.size.X*w/workers, g.size.X*(w+1)/workers
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				g.stepSlab(x0, x1)
+			}()
+		}
+		wg.Wait()
+	}
+	g.cells, g.next = g.next, g.cells
+	g.dying, g.nextDying = g.nextDying, g.dying
+	g.generation++
+}
+
+// stepSlab fills in the next generation for the rows with x0 <= x < x1.
+func (g *BitGrid) stepSlab(x0, x1 int) {
+	// counters[b] holds bit b of the neighbor count of every cell in a row
+	counters := make([][]uint64, g.counterBits)
+	for b := range counters {
+		counters[b] = make([]uint64, g.rowWords)
+	}
+	shifted := make([]uint64, g.rowWords)
+	wall := make([]uint64, g.rowWords)
+	var votes speciesVotes
+	if g.rule.Species > 1 {
+		votes = newSpeciesVotes(g.rule)
+	}
+
+	for x := x0; x < x1; x++ {
+		for y := 0; y < g.size.Y; y++ {
+			for b := range counters {
+				clear(counters[b])
+			}
+
+			for _, column := range g.columns[g.lattice.class(x, y)] {
+				source, inWall := g.sourceRow(x+column.dx, y+column.dy, wall)
+				for _, dz := range column.dz {
+					if inWall {
+						// A wall is the same all along z, and the x and y walls take
+						// precedence over the z boundary, like in Grid
+						addToCounters(counters, source)
+						continue
+					}
+					g.shiftRow(source, dz, shifted)
+					addToCounters(counters, shifted)
+				}
+			}
+
+			g.applyRule(counters, x, y, votes)
+		}
+	}
+}
+
+// sourceRow returns the row of cells at x, y after the boundary has had its say. A row in a
+// fixed wall is written into wall, and inWall is set.
+func (g *BitGrid) sourceRow(x, y int, wall []uint64) (row []uint64, inWall bool) {
+	x, xInside, xAlive := g.boundary.wrap(0, x, g.size.X)
+	y, yInside, yAlive := g.boundary.wrap(1, y, g.size.Y)
+	if xInside && yInside {
+		return g.row(g.cells, x, y), false
+	}
+
+	fill := uint64(0)
+	if (!xInside && xAlive) || (xInside && yAlive) {
+		fill = ^uint64(0)
+	}
+	for i := range wall {
+		wall[i] = fill
+	}
+	wall[len(wall)-1] &= g.lastMask
+	return wall, true
+}
+
+// shiftRow writes the row seen from dz cells further along z into dst, so that bit z of dst
+// is the cell at z+dz. Cells past the ends of the row come from the z boundary.
+func (g *BitGrid) shiftRow(src []uint64, dz int, dst []uint64) {
+	n := len(src)
+	word := func(i int) uint64 {
+		if i < 0 || i >= n {
+			return 0
+		}
+		return src[i]
+	}
+
+	shift := abs(dz)
+	wordShift, bitShift := shift/64, uint(shift%64)
+	for i := range dst {
+		if dz >= 0 {
+			dst[i] = word(i+wordShift) >> bitShift
+			if bitShift != 0 {
+				dst[i] |= word(i+wordShift+1) << (64 - bitShift)
+			}
+		} else {
+			dst[i] = word(i-wordShift) << bitShift
+			if bitShift != 0 {
+				dst[i] |= word(i-wordShift-1) >> (64 - bitShift)
+			}
+		}
+	}
+	dst[n-1] &= g.lastMask
+
+	// Patch the cells whose neighbor lies past the end of the row
+	first, last := g.size.Z-dz, g.size.Z
+	if dz < 0 {
+		first, last = 0, -dz
+	}
+	for z := max(first, 0); z < min(last, g.size.Z); z++ {
+		source, inside, alive := g.boundary.wrap(2, z+dz, g.size.Z)
+		if inside {
+			alive = src[source/64]&(1<<(source%64)) != 0
+		}
+		if alive {
+			dst[z/64] |= 1 << (z % 64)
+		} else {
+			dst[z/64] &^= 1 << (z % 64)
+		}
+	}
+}
+
+// addToCounters adds one bit per cell to the bit-sliced counters, rippling the carry up
+// through the counter bits like a chain of half adders.
+func addToCounters(counters [][]uint64, add []uint64) {
+	for i, carry := range add {
+		for b := 0; b < len(counters) && carry != 0; b++ {
+			sum := counters[b][i] ^ carry
+			carry &= counters[b][i]
+			counters[b][i] = sum
+		}
+	}
+}
+
+// applyRule writes the next state of the row at x, y from its current state and neighbor
+// counts. Newborn cells of a rule with several species are given theirs with votes.
+func (g *BitGrid) applyRule(counters [][]uint64, x, y int, votes speciesVotes) {
+	current, next := g.row(g.cells, x, y), g.row(g.next, x, y)
+	dying, nextDying := g.row(g.dying, x, y), g.row(g.nextDying, x, y)
+	stochastic := g.rule.Stochastic()
+	for i := range next {
+		var born, survives uint64
+		for count := 0; count < 1<<len(counters); count++ {
+			birth, survival := g.rule.Born(count), g.rule.Survives(count)
+			if !birth && !survival {
+				continue
+			}
+			// Select the cells whose counter equals count
+			match := ^uint64(0)
+			for b := range counters {
+				if count&(1<<b) != 0 {
+					match &= counters[b][i]
+				} else {
+					match &^= counters[b][i]
+				}
+			}
+			if birth {
+				born |= match
+			}
+			if survival {
+				survives |= match
+			}
+		}
+		// Dying cells can't be born again until they are dead
+		dead := ^current[i] &^ dying[i]
+		kept, newborn := current[i]&survives, dead&born
+		if stochastic {
+			kept, newborn = g.rollDice(x, y, i, kept, dead, born)
+		}
+		next[i] = kept | newborn
+		nextDying[i] = 0
+		if g.rule.States > 2 {
+			nextDying[i] = g.ageDying(x, y, i, dying[i], current[i]&^kept)
+		}
+		if votes != nil {
+			for born := next[i] &^ current[i] & g.lastWordMask(i); born != 0; born &= born - 1 {
+				p := Point{x, y, i*64 + bits.TrailingZeros64(born)}
+				g.species[g.index(p)] = g.parentSpecies(p, votes)
+			}
+		}
+	}
+	next[len(next)-1] &= g.lastMask
+	nextDying[len(next)-1] &= g.lastMask
+}
+
+// rollDice decides the births and survivals of word i of the row at x, y for stochastic rules.
+// survivors are the alive cells the counts keep, dead the cells that can be born, and born those
+// the counts call for. It returns the cells that stay alive and the cells that are born.
+func (g *BitGrid) rollDice(x, y, i int, survivors, dead, born uint64) (kept, newborn uint64) {
+	for word := survivors; word != 0; word &= word - 1 {
+		bit := bits.TrailingZeros64(word)
+		d := newDice(g.seed, g.generation, Point{x, y, i*64 + bit})
+		if g.rule.rollSurvival(&d) {
+			kept |= 1 << bit
+		}
+	}
+	// Noise can bring any dead cell to life, not just those the counts call for
+	candidates := dead & born
+	if g.rule.Noise > 0 {
+		candidates = dead
+	}
+	for word := candidates & g.lastWordMask(i); word != 0; word &= word - 1 {
+		bit := bits.TrailingZeros64(word)
+		d := newDice(g.seed, g.generation, Point{x, y, i*64 + bit})
+		if g.rule.rollBirth(born&(1<<bit) != 0, &d) {
+			newborn |= 1 << bit
+		}
+	}
+	return kept, newborn
+}
+
+// ageDying moves the dying cells of word i of the row at x, y one state closer to death, and
+// starts the cells in starting dying. It returns which cells are still dying.
+func (g *BitGrid) ageDying(x, y, i int, dying, starting uint64) uint64 {
+	var stillDying uint64
+	base := (x*g.size.Y+y)*g.size.Z + i*64
+	for word := dying | starting; word != 0; word &= word - 1 {
+		bit := bits.TrailingZeros64(word)
+		state := StateDying
+		if dying&(1<<bit) != 0 {
+			state = int(g.ages[base+bit]) + 1
+		}
+		if state < g.rule.States {
+			g.ages[base+bit] = uint8(state)
+			stillDying |= 1 << bit
+		}
+	}
+	return stillDying
+}
+
+// lastWordMask returns the bits of word i of a row that hold cells.
+func (g *BitGrid) lastWordMask(i int) uint64 {
+	if i == g.rowWords-1 {
+		return g.lastMask
+	}
+	return ^uint64(0)
+}
+
+// parentSpecies returns the species a cell born at p takes from its live neighbors.
+func (g *BitGrid) parentSpecies(p Point, votes speciesVotes) uint8 {
+	for _, column := range g.columns[g.lattice.class(p.X, p.Y)] {
+		for _, dz := range column.dz {
+			neighbor, inside, _ := g.boundary.neighbor(p, [3]int{column.dx, column.dy, dz}, g.size)
+			if inside && g.Alive(neighbor) {
+				votes.add(g.species[g.index(neighbor)])
+			}
+		}
+	}
+	return votes.winner(p)
+}
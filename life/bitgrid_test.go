@@ -0,0 +1,64 @@
+package life
+
+import "testing"
+
+// TestBitGridMatchesGrid steps the same soups in a BitGrid and a Grid, which must agree on
+// every cell's state and species after every generation.
+func TestBitGridMatchesGrid(t *testing.T) {
+	rules := []string{
+		"B5-7/S4-9",
+		"4555",
+		"B4/S4/NV",
+		"B3-6/S5-9/NE2",
+		"B6-8/S4-7/C10",
+		"B5-7/S4-9/K3",
+		"B5-7/S4-9/PB0.8/PS0.9/PN0.001",
+	}
+	boundaries := []string{"periodic", "dead", "alive", "reflect", "periodic,alive:dead,reflect:dead"}
+	// Depths past 64 cells spill rows into a second word
+	sizes := []Size{{X: 7, Y: 9, Z: 5}, {X: 5, Y: 6, Z: 70}}
+	for _, r := range rules {
+		for _, b := range boundaries {
+			for _, lattice := range []Lattice{Cubic, FCC, HCP} {
+				for _, size := range sizes {
+					rule, boundary := MustParseRule(r), MustParseBoundary(b)
+					grid := soupGrid(size, rule, boundary, lattice, 11)
+					bits := NewBitGrid(size, rule, boundary)
+					bits.SetLattice(lattice)
+					bits.SetSeed(11)
+					for _, p := range grid.LiveCells() {
+						bits.Set(p, true)
+						if rule.Species > 1 {
+							bits.SetSpecies(p, grid.Species(p))
+						}
+					}
+					for generation := 1; generation <= 8; generation++ {
+						grid.Step()
+						bits.Step()
+						if p, ok := firstDifference(grid, bits, size); !ok {
+							t.Errorf("rule %s, boundary %s, %s lattice, %v box: generation %d differs at %v: grid has state %d species %d, bit grid state %d species %d",
+								r, b, lattice, size, generation, p, grid.State(p), grid.Species(p), bits.State(p), bits.Species(p))
+							break
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// firstDifference returns the first cell of a box whose state or species differ between two
+// worlds, and whether they all match.
+func firstDifference(a, b Multispecies, size Size) (Point, bool) {
+	for x := 0; x < size.X; x++ {
+		for y := 0; y < size.Y; y++ {
+			for z := 0; z < size.Z; z++ {
+				p := Point{x, y, z}
+				if a.State(p) != b.State(p) || (a.Alive(p) && a.Species(p) != b.Species(p)) {
+					return p, false
+				}
+			}
+		}
+	}
+	return Point{}, true
+}
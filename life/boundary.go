@@ -0,0 +1,150 @@
+package life
+
+import (
+	"fmt"
+	"strings"
+)
+
+// BoundaryMode decides what a cell sees when its neighbors lie past a face of the pillar.
+type BoundaryMode int
+
+const (
+	// Periodic wraps around to the opposite face, like a torus.
+	Periodic BoundaryMode = iota
+	// Dead acts like a wall of dead cells.
+	Dead
+	// Alive acts like a wall of alive cells.
+	Alive
+	// Reflective mirrors the cells just inside the face.
+	Reflective
+)
+
+var boundaryModeNames = map[BoundaryMode]string{
+	Periodic:   "periodic",
+	Dead:       "dead",
+	Alive:      "alive",
+	Reflective: "reflect",
+}
+
+// Boundary holds the mode of the low and high face of each axis, indexed as [axis][face].
+// Axis 0 is x, 1 is y (up) and 2 is z. Face 0 is the low end and face 1 the high end.
+type Boundary [3][2]BoundaryMode
+
+// Torus wraps every axis, which makes the grid a 3-torus.
+var Torus = Boundary{}
+
+// ParseBoundary parses a boundary. A single mode ("periodic", "dead", "alive" or "reflect")
+// applies to every face. Otherwise three comma separated axes (x,y,z) are given, each as a
+// single mode or as "low:high" to use different modes on the two faces, e.g.
+// "periodic,alive:dead,periodic".
+func ParseBoundary(s string) (Boundary, error) {
+	var b Boundary
+	text := strings.ToLower(strings.TrimSpace(s))
+	axes := strings.Split(text, ",")
+	if len(axes) == 1 {
+		axes = []string{text, text, text}
+	}
+	if len(axes) != 3 {
+		return b, fmt.Errorf("boundary %q: expected one mode or three comma separated axes", s)
+	}
+
+	for axis, spec := range axes {
+		low, high, split := strings.Cut(spec, ":")
+		if !split {
+			high = low
+		}
+		for face, name := range []string{low, high} {
+			mode, err := parseBoundaryMode(name)
+			if err != nil {
+				return b, fmt.Errorf("boundary %q: %w", s, err)
+			}
+			b[axis][face] = mode
+		}
+		if (b[axis][0] == Periodic) != (b[axis][1] == Periodic) {
+			return b, fmt.Errorf("boundary %q: axis %c can't be periodic on only one face", s, "xyz"[axis])
+		}
+	}
+	return b, nil
+}
+
+// MustParseBoundary is like ParseBoundary but panics if the boundary can't be parsed.
+func MustParseBoundary(s string) Boundary {
+	b, err := ParseBoundary(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func parseBoundaryMode(name string) (BoundaryMode, error) {
+	switch name {
+	case "periodic", "wrap", "torus":
+		return Periodic, nil
+	case "dead", "empty":
+		return Dead, nil
+	case "alive", "solid":
+		return Alive, nil
+	case "reflect", "reflective", "mirror":
+		return Reflective, nil
+	}
+	return 0, fmt.Errorf("unknown boundary mode %q, use periodic, dead, alive or reflect", name)
+}
+
+// String returns the boundary in the notation ParseBoundary reads, as short as possible.
+func (b Boundary) String() string {
+	axes := make([]string, 3)
+	for axis, faces := range b {
+		axes[axis] = boundaryModeNames[faces[0]]
+		if faces[0] != faces[1] {
+			axes[axis] += ":" + boundaryModeNames[faces[1]]
+		}
+	}
+	if axes[0] == axes[1] && axes[1] == axes[2] {
+		return axes[0]
+	}
+	return strings.Join(axes, ",")
+}
+
+// wrap maps coordinate c on an axis of the given size to a cell inside the pillar. When c
+// lands in a fixed wall instead, inside is false and alive tells what the wall holds.
+func (b Boundary) wrap(axis, c, size int) (index int, inside bool, alive bool) {
+	for c < 0 || c >= size {
+		face := 0
+		if c >= size {
+			face = 1
+		}
+		switch b[axis][face] {
+		case Periodic:
+			c = (c%size + size) % size
+		case Dead:
+			return 0, false, false
+		case Alive:
+			return 0, false, true
+		case Reflective:
+			// Mirror across the face so the edge cell is its own first neighbor. A neighborhood
+			// wider than the pillar can land past the other face, so keep going.
+			if face == 0 {
+				c = -c - 1
+			} else {
+				c = 2*size - c - 1
+			}
+		}
+	}
+	return c, true, false
+}
+
+// neighbor maps the cell at offset from p to a cell inside a box of the given size, one axis
+// after the other. When it lands in a fixed wall instead, inside is false and alive tells what
+// the wall holds.
+func (b Boundary) neighbor(p Point, offset [3]int, size Size) (q Point, inside bool, alive bool) {
+	if q.X, inside, alive = b.wrap(0, p.X+offset[0], size.X); !inside {
+		return q, false, alive
+	}
+	if q.Y, inside, alive = b.wrap(1, p.Y+offset[1], size.Y); !inside {
+		return q, false, alive
+	}
+	if q.Z, inside, alive = b.wrap(2, p.Z+offset[2], size.Z); !inside {
+		return q, false, alive
+	}
+	return q, true, false
+}
@@ -0,0 +1,123 @@
+package life
+
+import "testing"
+
+func TestBoundaryWrap(t *testing.T) {
+	// where a coordinate lands on an axis: in the cell at index, or in a wall that is alive or not
+	type landing struct {
+		index  int
+		inside bool
+		alive  bool
+	}
+	cell := func(index int) landing { return landing{index: index, inside: true} }
+	deadWall := landing{}
+	aliveWall := landing{alive: true}
+
+	tests := []struct {
+		boundary string
+		c, size  int
+		want     landing
+	}{
+		// Coordinates inside the pillar stay where they are, whatever the faces
+		{"dead", 0, 5, cell(0)},
+		{"alive", 4, 5, cell(4)},
+		{"reflect", 2, 5, cell(2)},
+
+		{"periodic", -1, 5, cell(4)},
+		{"periodic", 5, 5, cell(0)},
+		{"periodic", -6, 5, cell(4)},
+		{"periodic", 12, 5, cell(2)},
+
+		{"dead", -1, 5, deadWall},
+		{"dead", 5, 5, deadWall},
+		{"alive", -1, 5, aliveWall},
+		{"alive", 7, 5, aliveWall},
+
+		// The edge cell is its own first neighbor past a reflective face
+		{"reflect", -1, 5, cell(0)},
+		{"reflect", -2, 5, cell(1)},
+		{"reflect", 5, 5, cell(4)},
+		{"reflect", 6, 5, cell(3)},
+
+		// Each face keeps its own mode
+		{"dead:alive,periodic,periodic", -1, 5, deadWall},
+		{"dead:alive,periodic,periodic", 5, 5, aliveWall},
+		{"reflect:alive,periodic,periodic", -1, 5, cell(0)},
+		{"reflect:alive,periodic,periodic", 5, 5, aliveWall},
+
+		// Neighborhoods wider than the pillar reflect off one face and past the other
+		{"reflect", -3, 2, cell(1)},
+		{"reflect", 5, 2, cell(1)},
+		{"reflect", 3, 1, cell(0)},
+		{"reflect", -4, 1, cell(0)},
+		{"reflect:dead,periodic,periodic", -3, 2, deadWall},
+		{"alive:reflect,periodic,periodic", 4, 2, aliveWall},
+	}
+	for _, test := range tests {
+		b := MustParseBoundary(test.boundary)
+		index, inside, alive := b.wrap(0, test.c, test.size)
+		got := landing{index, inside, alive}
+		if !inside {
+			got.index = 0
+		}
+		if got != test.want {
+			t.Errorf("%s: wrap(%d) on an axis of %d = %+v, want %+v", test.boundary, test.c, test.size, got, test.want)
+		}
+	}
+}
+
+func TestBoundaryNeighbor(t *testing.T) {
+	// x wraps, y is alive below and dead above, and z wraps
+	b := MustParseBoundary("periodic,alive:dead,periodic")
+	size := Size{X: 4, Y: 4, Z: 4}
+	tests := []struct {
+		p      Point
+		offset [3]int
+		want   Point
+		inside bool
+		alive  bool
+	}{
+		{Point{1, 1, 1}, [3]int{1, 1, -1}, Point{2, 2, 0}, true, false},
+		{Point{0, 1, 0}, [3]int{-1, 0, -1}, Point{3, 1, 3}, true, false},
+		{Point{3, 2, 3}, [3]int{1, 1, 1}, Point{0, 3, 0}, true, false},
+		{Point{1, 0, 1}, [3]int{0, -1, 0}, Point{}, false, true},
+		{Point{1, 3, 1}, [3]int{0, 1, 0}, Point{}, false, false},
+		// The wall decides even when the other axes wrap
+		{Point{0, 0, 0}, [3]int{-1, -1, -1}, Point{}, false, true},
+		{Point{3, 3, 3}, [3]int{1, 1, 1}, Point{}, false, false},
+	}
+	for _, test := range tests {
+		q, inside, alive := b.neighbor(test.p, test.offset, size)
+		if inside != test.inside || alive != test.alive || (inside && q != test.want) {
+			t.Errorf("neighbor of %v at %v = %v, inside %t, alive %t, want %v, inside %t, alive %t",
+				test.p, test.offset, q, inside, alive, test.want, test.inside, test.alive)
+		}
+	}
+}
+
+func TestParseBoundary(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Boundary
+	}{
+		{"periodic", Torus},
+		{"dead", Boundary{{Dead, Dead}, {Dead, Dead}, {Dead, Dead}}},
+		{"periodic,alive:dead,periodic", Boundary{{Periodic, Periodic}, {Alive, Dead}, {Periodic, Periodic}}},
+		{"mirror,solid,empty", Boundary{{Reflective, Reflective}, {Alive, Alive}, {Dead, Dead}}},
+	}
+	for _, test := range tests {
+		b, err := ParseBoundary(test.s)
+		if err != nil || b != test.want {
+			t.Errorf("ParseBoundary(%q) = %v, %v, want %v", test.s, b, err, test.want)
+			continue
+		}
+		if again := MustParseBoundary(b.String()); again != b {
+			t.Errorf("boundary %q reads back from %q as %v", test.s, b.String(), again)
+		}
+	}
+	for _, s := range []string{"", "sideways", "periodic,dead", "periodic:dead,dead,dead"} {
+		if _, err := ParseBoundary(s); err == nil {
+			t.Errorf("ParseBoundary(%q) succeeded, want an error", s)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package life
+
+import (
+	"fmt"
+	"math"
+)
+
+// Fate is what a world has settled into.
+type Fate int
+
+const (
+	// Running worlds haven't repeated a recent generation
+	Running Fate = iota
+	// Extinct worlds have no live cells left, and none can be born again
+	Extinct
+	// Still worlds are the same every generation
+	Still
+	// Oscillating worlds repeat the same generations over and over
+	Oscillating
+)
+
+// Verdict is what a Detector makes of a world.
+type Verdict struct {
+	Fate Fate
+	// Number of generations the world takes to repeat, 1 for still worlds and 0 for running
+	// and extinct ones
+	Period int
+	// Generation the world first reached the state it repeats, or the first extinct generation
+	Since int
+}
+
+// String describes the verdict, like "still life" or "period 3 oscillator".
+func (v Verdict) String() string {
+	switch v.Fate {
+	case Extinct:
+		return "extinct"
+	case Still:
+		return "still life"
+	case Oscillating:
+		return fmt.Sprintf("period %d oscillator", v.Period)
+	default:
+		return "running"
+	}
+}
+
+// Settled reports whether the world has died out or repeats itself.
+func (v Verdict) Settled() bool {
+	return v.Fate != Running
+}
+
+// Detector watches the generations of a world for extinction, still lives and oscillators with a
+// period up to a limit. Each generation is boiled down to a hash, and the world repeats itself
+// when a hash comes back.
+//
+// Repeating a state only means a cycle when the rule leaves nothing to chance, so worlds with
+// stochastic rules are only ever found extinct, and only when nothing can bring them back.
+type Detector struct {
+	maxPeriod int
+	// hashes of the last generations, the most recent last
+	hashes []uint64
+	// the generation observed last, so a gap can be noticed
+	last int
+	// the verdict once the world has settled, which stays until the world is reset
+	verdict Verdict
+}
+
+// NewDetector creates a detector for oscillators with a period up to maxPeriod.
+func NewDetector(maxPeriod int) *Detector {
+	return &Detector{maxPeriod: max(maxPeriod, 1)}
+}
+
+// Reset forgets every generation seen so far, for when the world is replaced or changed by hand.
+func (d *Detector) Reset() {
+	d.hashes = d.hashes[:0]
+	d.verdict = Verdict{}
+}
+
+// Verdict returns what the detector made of the last generation it saw.
+func (d *Detector) Verdict() Verdict {
+	return d.verdict
+}
+
+// Observe looks at the current generation of the world and returns what the world has settled
+// into. Generations should be observed one after another. A gap, like after skipping ahead,
+// starts the watch over.
+func (d *Detector) Observe(w World) Verdict {
+	generation := w.Generation()
+	if (len(d.hashes) > 0 || d.verdict.Settled()) && generation != d.last+1 {
+		d.Reset()
+	}
+	d.last = generation
+	if d.verdict.Settled() {
+		return d.verdict
+	}
+
+	rule := w.Rule()
+	if w.Population() == 0 && !canRevive(w) && !hasDying(w) {
+		d.verdict = Verdict{Fate: Extinct, Since: generation}
+		return d.verdict
+	}
+
+	hash := Hash(w)
+	// Continuous worlds don't run their rule, so it can't make them stochastic
+	if _, continuous := w.(Continuous); continuous || !rule.Stochastic() {
+		for period := 1; period <= min(d.maxPeriod, len(d.hashes)); period++ {
+			if d.hashes[len(d.hashes)-period] == hash {
+				d.verdict = Verdict{Fate: Oscillating, Period: period, Since: generation - period}
+				switch {
+				case period == 1 && w.Population() == 0:
+					// An empty world that stays empty, like one walled in by alive cells too few
+					// to give birth
+					d.verdict = Verdict{Fate: Extinct, Since: generation - 1}
+				case period == 1:
+					d.verdict.Fate = Still
+				}
+				return d.verdict
+			}
+		}
+	}
+
+	d.hashes = append(d.hashes, hash)
+	if len(d.hashes) > d.maxPeriod {
+		d.hashes = append(d.hashes[:0], d.hashes[1:]...)
+	}
+	return d.verdict
+}
+
+// canRevive reports whether cells can be born in a world without a live or dying cell: from
+// noise, from rules that give birth with no neighbors, or next to a wall of alive cells.
+func canRevive(w World) bool {
+	rule := w.Rule()
+	if rule.Noise > 0 || rule.Born(0) {
+		return true
+	}
+	if bounded, ok := w.(Bounded); ok {
+		for _, faces := range bounded.Boundary() {
+			if faces[0] == Alive || faces[1] == Alive {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasDying reports whether a bounded world still has dying cells, which keep changing after the
+// last live cell is gone.
+func hasDying(w World) bool {
+	bounded, ok := w.(Bounded)
+	if !ok || w.Rule().States <= 2 {
+		return false
+	}
+	size := bounded.Size()
+	for x := 0; x < size.X; x++ {
+		for y := 0; y < size.Y; y++ {
+			for z := 0; z < size.Z; z++ {
+				if w.State(Point{x, y, z}) >= StateDying {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// Hash boils the current generation of a world down to a number. Worlds with the same cells give
+// the same hash, whatever order they keep their cells in. Dying cells are included for worlds in
+// a box, species for rules with several, and values rounded to 1/1024 for continuous worlds.
+func Hash(w World) uint64 {
+	var h uint64
+	add := func(p Point, value uint64) {
+		cell := dice{state: hashPoint(p) ^ value}
+		h += cell.next()
+	}
+
+	rule := w.Rule()
+	sized, isSized := w.(interface{ Size() Size })
+	continuous, isContinuous := w.(Continuous)
+	multi, isMulti := w.(Multispecies)
+	isMulti = isMulti && rule.Species > 1
+	switch {
+	case isContinuous && isSized:
+		size := sized.Size()
+		for x := 0; x < size.X; x++ {
+			for y := 0; y < size.Y; y++ {
+				for z := 0; z < size.Z; z++ {
+					p := Point{x, y, z}
+					if v := math.Round(continuous.Value(p) * 1024); v > 0 {
+						add(p, uint64(v))
+					}
+				}
+			}
+		}
+	case isSized && (rule.States > 2 || isMulti):
+		size := sized.Size()
+		for x := 0; x < size.X; x++ {
+			for y := 0; y < size.Y; y++ {
+				for z := 0; z < size.Z; z++ {
+					p := Point{x, y, z}
+					state := w.State(p)
+					if state == StateDead {
+						continue
+					}
+					species := 0
+					if isMulti {
+						species = multi.Species(p)
+					}
+					add(p, uint64(state)|uint64(species)<<8)
+				}
+			}
+		}
+	default:
+		for _, p := range w.LiveCells() {
+			species := 0
+			if isMulti {
+				species = multi.Species(p)
+			}
+			add(p, uint64(StateAlive)|uint64(species)<<8)
+		}
+	}
+	return h
+}
@@ -0,0 +1,87 @@
+package life
+
+import "testing"
+
+// observeSteps observes a world, then steps and observes it n times, returning the verdicts.
+func observeSteps(d *Detector, w World, n int) []Verdict {
+	verdicts := []Verdict{d.Observe(w)}
+	for i := 0; i < n; i++ {
+		w.Step()
+		verdicts = append(verdicts, d.Observe(w))
+	}
+	return verdicts
+}
+
+func TestDetectorEmptyWorlds(t *testing.T) {
+	size := Size{X: 6, Y: 6, Z: 6}
+	tests := []struct {
+		rule, boundary string
+		// what the world has settled into after a few generations, and whether any cell is born
+		want Fate
+		born bool
+	}{
+		{"B5-7/S4-9", "periodic", Extinct, false},
+		{"B5-7/S4-9", "dead", Extinct, false},
+		{"B4/S/C5", "reflect", Extinct, false},
+		// Every cell is born from nothing, then dies from crowding, over and over
+		{"B0/S", "periodic", Oscillating, true},
+		{"B0/S", "dead", Oscillating, true},
+		// The cells along an alive face have 9 alive neighbors, and the births spread inwards
+		{"B9/S", "alive", Oscillating, true},
+		{"B9/S", "periodic,dead:alive,periodic", Running, true},
+		// An alive wall that can't give birth leaves the world as dead as any other
+		{"B5-7/S4-9", "alive", Extinct, false},
+	}
+	for _, test := range tests {
+		g := NewGrid(size, MustParseRule(test.rule), MustParseBoundary(test.boundary))
+		d := NewDetector(4)
+		v, born := d.Observe(g), false
+		for generation := 1; generation <= 6; generation++ {
+			g.Step()
+			born = born || g.Population() > 0
+			if v = d.Observe(g); v.Fate == Extinct && test.want != Extinct {
+				t.Errorf("rule %s, boundary %s: found extinct at generation %d", test.rule, test.boundary, generation)
+				break
+			}
+		}
+		if born != test.born {
+			t.Errorf("rule %s, boundary %s: cells born %t, want %t", test.rule, test.boundary, born, test.born)
+		}
+		if v.Fate != test.want {
+			t.Errorf("rule %s, boundary %s: found %s, want fate %d", test.rule, test.boundary, v, test.want)
+		}
+	}
+}
+
+func TestDetectorNoise(t *testing.T) {
+	// Noise can bring an empty world back, so it's never extinct, and chance rules have no cycles
+	g := NewGrid(Size{X: 6, Y: 6, Z: 6}, MustParseRule("B5-7/S4-9/PN0.01"), Torus)
+	for generation, v := range observeSteps(NewDetector(4), g, 10) {
+		if v.Settled() {
+			t.Fatalf("noisy world found %s at generation %d", v, generation)
+		}
+	}
+}
+
+func TestDetectorStillLife(t *testing.T) {
+	// Each cell of a 2x2x2 block has 7 neighbors, and no cell around it more than 4
+	g := NewGrid(Size{X: 8, Y: 8, Z: 8}, DefaultRule, Torus)
+	for _, p := range []Point{{3, 3, 3}, {3, 3, 4}, {3, 4, 3}, {3, 4, 4}, {4, 3, 3}, {4, 3, 4}, {4, 4, 3}, {4, 4, 4}} {
+		g.Set(p, true)
+	}
+	d := NewDetector(4)
+	verdicts := observeSteps(d, g, 2)
+	if verdicts[0].Settled() {
+		t.Errorf("block found %s before it was seen twice", verdicts[0])
+	}
+	if want := (Verdict{Fate: Still, Period: 1}); verdicts[1] != want || d.Verdict() != want {
+		t.Errorf("block found %+v, want %+v", d.Verdict(), want)
+	}
+
+	// Skipping a generation starts the watch over
+	g.Step()
+	g.Step()
+	if v := d.Observe(g); v.Settled() {
+		t.Errorf("block found %s right after a gap", v)
+	}
+}
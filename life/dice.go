@@ -0,0 +1,36 @@
+package life
+
+// dice rolls the random numbers of one cell in one generation. They are worked out from the
+// world's seed, the generation and the cell's position alone, so a stochastic rule gives the
+// same run from the same seed whatever order cells are stepped in and however many goroutines
+// step them.
+type dice struct {
+	state uint64
+}
+
+func newDice(seed int64, generation int, p Point) dice {
+	d := dice{state: uint64(seed)}
+	d.state = d.next() ^ uint64(generation)
+	d.state = d.next() ^ hashPoint(p)
+	return d
+}
+
+// next returns the next number of a SplitMix64 sequence.
+func (d *dice) next() uint64 {
+	d.state += 0x9e3779b97f4a7c15
+	z := d.state
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	return z ^ z>>31
+}
+
+// chance returns true with probability p. Certain and impossible outcomes don't use up a roll.
+func (d *dice) chance(p float64) bool {
+	switch {
+	case p >= 1:
+		return true
+	case p <= 0:
+		return false
+	}
+	return float64(d.next()>>11)/(1<<53) < p
+}
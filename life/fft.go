@@ -0,0 +1,124 @@
+package life
+
+import (
+	"math"
+	"math/bits"
+	"math/cmplx"
+	"sync"
+)
+
+// fft3 transforms 3D complex fields of a fixed size with the discrete Fourier transform, one
+// axis at a time. Axes whose length is a power of two use a radix-2 FFT, the others fall back
+// to a direct DFT, which is fine for the few dozen cells a pillar has along an axis.
+type fft3 struct {
+	size    Size
+	workers int
+	// twiddle factors e^(-2πik/n) of each axis
+	twiddles [3][]complex128
+}
+
+func newFFT3(size Size, workers int) *fft3 {
+	f := &fft3{size: size, workers: max(workers, 1)}
+	for axis, n := range [3]int{size.X, size.Y, size.Z} {
+		f.twiddles[axis] = make([]complex128, n)
+		for k := range f.twiddles[axis] {
+			f.twiddles[axis][k] = cmplx.Exp(complex(0, -2*math.Pi*float64(k)/float64(n)))
+		}
+	}
+	return f
+}
+
+// transform replaces data, ordered like Grid.Index, with its forward transform, or with the
+// inverse transform when inverse is set.
+func (f *fft3) transform(data []complex128, inverse bool) {
+	sizes := [3]int{f.size.X, f.size.Y, f.size.Z}
+	strides := [3]int{f.size.Y * f.size.Z, f.size.Z, 1}
+	for axis := range sizes {
+		n, stride := sizes[axis], strides[axis]
+		if n == 1 {
+			continue
+		}
+		// The lines along the axis start at every cell whose coordinate on the axis is 0
+		var starts []int
+		for i := range data {
+			if i/stride%n == 0 {
+				starts = append(starts, i)
+			}
+		}
+
+		workers := min(f.workers, len(starts))
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			lines := starts[len(starts)*w/workers : len(starts)*(w+1)/workers]
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				line := make([]complex128, n)
+				scratch := make([]complex128, n)
+				for _, start := range lines {
+					for i := range line {
+						line[i] = data[start+i*stride]
+					}
+					f.transformLine(line, scratch, axis, inverse)
+					for i := range line {
+						data[start+i*stride] = line[i]
+					}
+				}
+			}()
+		}
+		wg.Wait()
+	}
+
+	if inverse {
+		scale := complex(1/float64(len(data)), 0)
+		for i := range data {
+			data[i] *= scale
+		}
+	}
+}
+
+// transformLine transforms one line along an axis in place. The inverse transform isn't
+// scaled.
+func (f *fft3) transformLine(line, scratch []complex128, axis int, inverse bool) {
+	n := len(line)
+	twiddle := func(k int) complex128 {
+		t := f.twiddles[axis][k%n]
+		if inverse {
+			return cmplx.Conj(t)
+		}
+		return t
+	}
+
+	if n&(n-1) != 0 {
+		// Direct DFT
+		for k := range scratch {
+			var sum complex128
+			for i, v := range line {
+				sum += v * twiddle(i*k)
+			}
+			scratch[k] = sum
+		}
+		copy(line, scratch)
+		return
+	}
+
+	// Iterative radix-2 FFT: put the values in bit-reversed order, then combine ever longer
+	// runs with butterflies
+	shift := 64 - bits.Len(uint(n-1))
+	for i := range line {
+		j := int(bits.Reverse64(uint64(i)) >> shift)
+		if i < j {
+			line[i], line[j] = line[j], line[i]
+		}
+	}
+	for length := 2; length <= n; length *= 2 {
+		step := n / length
+		for start := 0; start < n; start += length {
+			for k := 0; k < length/2; k++ {
+				even, odd := line[start+k], line[start+k+length/2]*twiddle(k*step)
+				line[start+k] = even + odd
+				line[start+k+length/2] = even - odd
+			}
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package life
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+// Grid is a bounded world that stores every cell of a box. What lies past the faces of the
+// box is decided by its boundary.
+type Grid struct {
+	size     Size
+	rule     Rule
+	boundary Boundary
+	lattice  Lattice
+	// neighbor offsets of each class of row of the lattice, how far they reach, and how far
+	// apart the cells they point at are stored
+	offsets [][][3]int
+	radius  int
+	deltas  [][]int
+	// cells holds the state of every cell in the current generation and next is filled in
+	// while stepping
+	cells []uint8
+	next  []uint8
+	// For rules with several species, the species of every live and dying cell
+	species     []uint8
+	nextSpecies []uint8
+	// seed of the dice of stochastic rules
+	seed       int64
+	generation int
+	// how many goroutines Step splits the grid across
+	workers int
+}
+
+// NewGrid creates an empty grid. It panics if any side of the box is smaller than one cell.
+func NewGrid(size Size, rule Rule, boundary Boundary) *Grid {
+	if size.X < 1 || size.Y < 1 || size.Z < 1 {
+		panic(fmt.Sprintf("life: grid size %dx%dx%d must be at least 1x1x1", size.X, size.Y, size.Z))
+	}
+	g := &Grid{
+		size:     size,
+		boundary: boundary,
+		cells:    make([]uint8, size.Cells()),
+		next:     make([]uint8, size.Cells()),
+		workers:  runtime.GOMAXPROCS(0),
+	}
+	g.SetRule(rule)
+	return g
+}
+
+// Size returns the size of the grid's box.
+func (g *Grid) Size() Size {
+	return g.size
+}
+
+// Index returns where the cell at p is stored. Cells are ordered by x, then y, then z.
+func (g *Grid) Index(p Point) int {
+	return (p.X*g.size.Y+p.Y)*g.size.Z + p.Z
+}
+
+// Point returns the coordinates of the cell stored at index i.
+func (g *Grid) Point(i int) Point {
+	return Point{
+		X: i / (g.size.Y * g.size.Z),
+		Y: i / g.size.Z % g.size.Y,
+		Z: i % g.size.Z,
+	}
+}
+
+// Contains reports whether p lies inside the grid's box.
+func (g *Grid) Contains(p Point) bool {
+	return p.X >= 0 && p.X < g.size.X && p.Y >= 0 && p.Y < g.size.Y && p.Z >= 0 && p.Z < g.size.Z
+}
+
+// Generation returns how many generations the grid has advanced.
+func (g *Grid) Generation() int {
+	return g.generation
+}
+
+// Alive reports whether the cell at p is alive. Cells outside the box are dead.
+func (g *Grid) Alive(p Point) bool {
+	return g.State(p) == StateAlive
+}
+
+// State returns the state of the cell at p. Cells outside the box are dead.
+func (g *Grid) State(p Point) int {
+	if !g.Contains(p) {
+		return StateDead
+	}
+	return int(g.cells[g.Index(p)])
+}
+
+// Set makes the cell at p alive or dead. Cells outside the box are ignored.
+func (g *Grid) Set(p Point, alive bool) {
+	if !g.Contains(p) {
+		return
+	}
+	if alive {
+		g.cells[g.Index(p)] = StateAlive
+		if g.species != nil {
+			g.species[g.Index(p)] = 1
+		}
+	} else {
+		g.cells[g.Index(p)] = StateDead
+	}
+}
+
+// Species returns the species of the live or dying cell at p, and 0 for dead cells.
+func (g *Grid) Species(p Point) int {
+	switch {
+	case g.State(p) == StateDead:
+		return 0
+	case g.rule.Species <= 1:
+		return 1
+	default:
+		return int(g.species[g.Index(p)])
+	}
+}
+
+// SetSpecies makes the cell at p alive as a member of the given species. Cells outside the box
+// and species the rule doesn't have are ignored.
+func (g *Grid) SetSpecies(p Point, species int) {
+	if !g.Contains(p) || !validSpecies(g.rule, species) {
+		return
+	}
+	g.cells[g.Index(p)] = StateAlive
+	if g.species != nil {
+		g.species[g.Index(p)] = uint8(species)
+	}
+}
+
+// Population returns the number of live cells. Dying cells aren't counted.
+func (g *Grid) Population() int {
+	population := 0
+	for _, state := range g.cells {
+		if state == StateAlive {
+			population++
+		}
+	}
+	return population
+}
+
+// LiveCells returns the coordinates of every live cell in storage order.
+func (g *Grid) LiveCells() []Point {
+	var points []Point
+	for i, state := range g.cells {
+		if state == StateAlive {
+			points = append(points, g.Point(i))
+		}
+	}
+	return points
+}
+
+// Cells returns a copy of the state of every cell, in the order given by Index.
+func (g *Grid) Cells() []uint8 {
+	return append([]uint8(nil), g.cells...)
+}
+
+// Rule returns the rule the grid runs.
+func (g *Grid) Rule() Rule {
+	return g.rule
+}
+
+// SetRule changes the rule used for the following generations. Every rule can run on a grid.
+func (g *Grid) SetRule(r Rule) error {
+	if r.Species > 1 && g.rule.Species <= 1 {
+		// Every cell alive so far is of the first species
+		if g.species == nil {
+			g.species = make([]uint8, g.size.Cells())
+			g.nextSpecies = make([]uint8, g.size.Cells())
+		}
+		for i := range g.species {
+			g.species[i] = 1
+		}
+	} else if r.Species < g.rule.Species {
+		// Cells of species the rule no longer has join the ones it does
+		for i, species := range g.species {
+			g.species[i] = foldSpecies(species, r)
+		}
+	}
+	g.rule = r
+	g.setNeighbors()
+	return nil
+}
+
+// Seed returns the seed the grid rolls the dice of stochastic rules from.
+func (g *Grid) Seed() int64 {
+	return g.seed
+}
+
+// SetSeed changes the seed the grid rolls the dice of stochastic rules from.
+func (g *Grid) SetSeed(seed int64) {
+	g.seed = seed
+}
+
+// Lattice returns how the grid's cells are arranged.
+func (g *Grid) Lattice() Lattice {
+	return g.lattice
+}
+
+// SetLattice changes how the grid's cells are arranged for the following generations. The
+// cells keep their coordinates. Every lattice can run on a grid, though a periodic boundary
+// only joins up seamlessly when the size along x is even, and along y a multiple of 3 for FCC
+// and of 2 for HCP.
+func (g *Grid) SetLattice(l Lattice) error {
+	g.lattice = l
+	g.setNeighbors()
+	return nil
+}
+
+// setNeighbors works out the neighbor offsets for the rule and lattice.
+func (g *Grid) setNeighbors() {
+	g.offsets = g.lattice.offsets(g.rule.Neighborhood)
+	g.radius = reach(g.offsets)
+	g.deltas = make([][]int, len(g.offsets))
+	for class, offsets := range g.offsets {
+		g.deltas[class] = make([]int, len(offsets))
+		for i, offset := range offsets {
+			g.deltas[class][i] = (offset[0]*g.size.Y+offset[1])*g.size.Z + offset[2]
+		}
+	}
+}
+
+// Boundary returns what lies past the faces of the grid.
+func (g *Grid) Boundary() Boundary {
+	return g.boundary
+}
+
+// SetBoundary changes what lies past the faces of the grid for the following generations.
+func (g *Grid) SetBoundary(b Boundary) {
+	g.boundary = b
+}
+
+// Workers returns how many goroutines Step splits the grid across.
+func (g *Grid) Workers() int {
+	return g.workers
+}
+
+// SetWorkers sets how many goroutines Step splits the grid across. One steps the grid on the
+// calling goroutine. Values below one use a goroutine per CPU. The result of a step is the
+// same for any number of workers.
+func (g *Grid) SetWorkers(n int) {
+	if n < 1 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	g.workers = n
+}
+
+// Step advances the grid one generation. The grid is cut into slabs along the x axis that
+// are stepped in parallel. Every slab reads the current generation and writes its own part
+// of the next one, so they never touch the same memory.
+func (g *Grid) Step() {
+	workers := min(g.workers, g.size.X)
+	if workers <= 1 {
+		g.stepSlab(0, g.size.X)
+	} else {
+		var wg sync.WaitGroup
+		for w := 0; w < workers; w++ {
+			x0, x1 := g.size.X*w/workers, g.size.X*(w+1)/workers
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				g.stepSlab(x0, x1)
+			}()
+		}
+		wg.Wait()
+	}
+	g.cells, g.next = g.next, g.cells
+	if g.rule.Species > 1 {
+		g.species, g.nextSpecies = g.nextSpecies, g.species
+	}
+	g.generation++
+}
+
+// stepSlab fills in the next generation for the cells with x0 <= x < x1.
+func (g *Grid) stepSlab(x0, x1 int) {
+	var votes speciesVotes
+	if g.rule.Species > 1 {
+		votes = newSpeciesVotes(g.rule)
+	}
+	stochastic := g.rule.Stochastic()
+	for x := x0; x < x1; x++ {
+		xInside := x >= g.radius && x < g.size.X-g.radius
+		for y := 0; y < g.size.Y; y++ {
+			yInside := xInside && y >= g.radius && y < g.size.Y-g.radius
+			class := g.lattice.class(x, y)
+			for z := 0; z < g.size.Z; z++ {
+				index := (x*g.size.Y+y)*g.size.Z + z
+				var aliveNeighbors int
+				if yInside && z >= g.radius && z < g.size.Z-g.radius {
+					// The whole neighborhood is inside the box, so skip the boundary
+					aliveNeighbors = g.countInsideNeighbors(index, g.deltas[class])
+				} else {
+					aliveNeighbors = g.countAliveNeighbors(x, y, z, g.offsets[class])
+				}
+				if stochastic {
+					d := newDice(g.seed, g.generation, Point{x, y, z})
+					g.next[index] = uint8(g.rule.nextRandom(int(g.cells[index]), aliveNeighbors, &d))
+				} else {
+					g.next[index] = uint8(g.rule.Next(int(g.cells[index]), aliveNeighbors))
+				}
+				if votes != nil {
+					if g.cells[index] == StateDead && g.next[index] == StateAlive {
+						g.nextSpecies[index] = g.parentSpecies(x, y, z, g.offsets[class], votes)
+					} else {
+						g.nextSpecies[index] = g.species[index]
+					}
+				}
+			}
+		}
+	}
+}
+
+// countInsideNeighbors counts the live neighbors of a cell whose neighborhood doesn't cross
+// a face of the box.
+func (g *Grid) countInsideNeighbors(index int, deltas []int) int {
+	aliveNeighbors := 0
+	for _, delta := range deltas {
+		if g.cells[index+delta] == StateAlive {
+			aliveNeighbors++
+		}
+	}
+	return aliveNeighbors
+}
+
+// countAliveNeighbors counts the live cells at the given offsets from the cell at x, y, z.
+func (g *Grid) countAliveNeighbors(x, y, z int, offsets [][3]int) int {
+	aliveNeighbors := 0
+	for _, offset := range offsets {
+		// Let the boundary decide what lies past the faces
+		neighbor, inside, wallAlive := g.boundary.neighbor(Point{x, y, z}, offset, g.size)
+		if !inside {
+			if wallAlive {
+				aliveNeighbors++
+			}
+			continue
+		}
+
+		if g.cells[g.Index(neighbor)] == StateAlive {
+			aliveNeighbors++
+		}
+	}
+
+	return aliveNeighbors
+}
+
+// parentSpecies returns the species a cell born at x, y, z takes from its live neighbors at the
+// given offsets.
+func (g *Grid) parentSpecies(x, y, z int, offsets [][3]int, votes speciesVotes) uint8 {
+	for _, offset := range offsets {
+		neighbor, inside, _ := g.boundary.neighbor(Point{x, y, z}, offset, g.size)
+		if !inside {
+			continue
+		}
+		if index := g.Index(neighbor); g.cells[index] == StateAlive {
+			votes.add(g.species[index])
+		}
+	}
+	return votes.winner(Point{x, y, z})
+}
@@ -0,0 +1,63 @@
+package life
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+// soupGrid returns a grid filled with a random soup from the seed, with species shared out
+// for rules that have several.
+func soupGrid(size Size, rule Rule, boundary Boundary, lattice Lattice, seed int64) *Grid {
+	g := NewGrid(size, rule, boundary)
+	g.SetLattice(lattice)
+	g.SetSeed(seed)
+	FillRandom(g, size, 0.4, seed)
+	FillRandomSpecies(g, seed)
+	return g
+}
+
+func TestGridWorkersMatch(t *testing.T) {
+	rules := []string{"B5-7/S4-9", "4555", "B6-8/S4-7/C10", "B5-7/S4-9/K4", "B5-7/S4-9/PB0.8/PS0.9/PN0.001"}
+	size := Size{X: 23, Y: 17, Z: 11}
+	for _, r := range rules {
+		for _, lattice := range []Lattice{Cubic, FCC, HCP} {
+			serial := soupGrid(size, MustParseRule(r), MustParseBoundary("reflect,alive:dead,periodic"), lattice, 7)
+			serial.SetWorkers(1)
+			for i := 0; i < 10; i++ {
+				serial.Step()
+			}
+			// Odd worker counts leave slabs of different widths
+			for _, workers := range []int{2, 3, 7, max(runtime.GOMAXPROCS(0), 4)} {
+				parallel := soupGrid(size, MustParseRule(r), MustParseBoundary("reflect,alive:dead,periodic"), lattice, 7)
+				parallel.SetWorkers(workers)
+				for i := 0; i < 10; i++ {
+					parallel.Step()
+				}
+				if !bytes.Equal(serial.cells, parallel.cells) || !bytes.Equal(serial.species, parallel.species) {
+					t.Errorf("rule %s on the %s lattice: %d workers step to different cells than 1", r, lattice, workers)
+				}
+			}
+		}
+	}
+}
+
+func BenchmarkGridStep(b *testing.B) {
+	// The default pillar's soup, stepped on one goroutine and on one per CPU
+	size := Size{X: 100, Y: 200, Z: 100}
+	counts := []int{1}
+	if n := runtime.GOMAXPROCS(0); n > 1 {
+		counts = append(counts, n)
+	}
+	for _, workers := range counts {
+		b.Run(fmt.Sprintf("workers=%d", workers), func(b *testing.B) {
+			g := soupGrid(size, DefaultRule, Torus, Cubic, 42)
+			g.SetWorkers(workers)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				g.Step()
+			}
+		})
+	}
+}
@@ -0,0 +1,506 @@
+package life
+
+import (
+	"fmt"
+	"math/bits"
+)
+
+// HashLife is an unbounded world that stores space as an octree of canonical cubes and
+// memoizes how each cube evolves, the 3D form of Gosper's HashLife. A cube of side 2^k is
+// stored once no matter how often it appears, and the center of it 2^(k-2) generations
+// later is worked out once and remembered. Periodic and sparse patterns repeat the same
+// cubes over and over, so StepN can jump ahead billions of generations.
+//
+// Cubes are built from leaves of 4x4x4 cells packed into a uint64. Only radius 1
+// neighborhoods are supported, since the center of a cube can then only be reached by
+// cells of the cube itself.
+type HashLife struct {
+	rule    Rule
+	offsets [][3]int
+	// root holds all of space that has live cells, centered on the origin
+	root *octNode
+	// nodes interns every cube so equal cubes are the same node
+	nodes map[octKey]*octNode
+	// results remembers the center of a cube some power of two generations later
+	results map[resultKey]*octNode
+	// empty cubes of each level
+	empty      []*octNode
+	generation int
+}
+
+// octNode is a cube of 2^level cells a side. Leaves are level 2 and keep their cells in the
+// bits of leaf, larger cubes are made of eight children of the level below.
+type octNode struct {
+	level      int
+	leaf       uint64
+	children   [8]*octNode
+	population int
+}
+
+// octKey identifies a cube by its contents. Children are already canonical, so comparing
+// their pointers compares their contents.
+type octKey struct {
+	level    int
+	leaf     uint64
+	children [8]*octNode
+}
+
+// resultKey identifies the center of a cube 2^step generations later.
+type resultKey struct {
+	node *octNode
+	step int
+}
+
+const (
+	// leaves are cubes of 4x4x4 cells
+	leafLevel = 2
+	// the smallest cube whose future is computed cell by cell
+	baseLevel = 3
+	// once this many cubes are interned, the ones no longer in use are forgotten
+	maxOctNodes = 1 << 21
+)
+
+// octant returns the index of the child holding the cell at x, y, z of a cube, given the
+// bit of the coordinates that picks the half along each axis.
+func octant(x, y, z, bit int) int {
+	return (x>>bit&1)<<2 | (y>>bit&1)<<1 | z>>bit&1
+}
+
+// leafBit returns the bit of a leaf holding the cell at x, y, z.
+func leafBit(x, y, z int) uint64 {
+	return 1 << ((x*4+y)*4 + z)
+}
+
+// NewHashLife creates an empty HashLife world. It fails for rules HashLife can't run, see
+// CheckHashLifeRule.
+func NewHashLife(rule Rule) (*HashLife, error) {
+	h := &HashLife{}
+	if err := h.SetRule(rule); err != nil {
+		return nil, err
+	}
+	h.forget()
+	h.root = h.emptyNode(baseLevel)
+	return h, nil
+}
+
+// CheckHashLifeRule reports rules that HashLife can't run: rules that can't run unbounded,
+// Generations rules, rules with several species, stochastic rules, and neighborhoods with a
+// radius above one.
+func CheckHashLifeRule(rule Rule) error {
+	if err := CheckUnboundedRule(rule); err != nil {
+		return err
+	}
+	if rule.States > 2 {
+		return fmt.Errorf("hashlife only runs two state rules, rule %s has %d states", rule, rule.States)
+	}
+	if rule.Species > 1 {
+		return fmt.Errorf("hashlife only runs single species rules, rule %s has %d species", rule, rule.Species)
+	}
+	if rule.Stochastic() {
+		return fmt.Errorf("hashlife only runs rules that leave nothing to chance, rule %s is stochastic", rule)
+	}
+	if rule.Neighborhood.Radius != 1 {
+		return fmt.Errorf("hashlife needs a radius 1 neighborhood, rule %s has radius %d", rule, rule.Neighborhood.Radius)
+	}
+	return nil
+}
+
+// forget drops every interned cube and remembered result.
+func (h *HashLife) forget() {
+	h.nodes = make(map[octKey]*octNode)
+	h.results = make(map[resultKey]*octNode)
+	h.empty = nil
+}
+
+// leafNode returns the canonical leaf holding the given cells.
+func (h *HashLife) leafNode(cells uint64) *octNode {
+	key := octKey{level: leafLevel, leaf: cells}
+	if n, ok := h.nodes[key]; ok {
+		return n
+	}
+	n := &octNode{level: leafLevel, leaf: cells, population: bits.OnesCount64(cells)}
+	h.nodes[key] = n
+	return n
+}
+
+// joinNodes returns the canonical cube made of the given children.
+func (h *HashLife) joinNodes(children [8]*octNode) *octNode {
+	key := octKey{level: children[0].level + 1, children: children}
+	if n, ok := h.nodes[key]; ok {
+		return n
+	}
+	n := &octNode{level: key.level, children: children}
+	for _, child := range children {
+		n.population += child.population
+	}
+	h.nodes[key] = n
+	return n
+}
+
+// emptyNode returns the empty cube of a level.
+func (h *HashLife) emptyNode(level int) *octNode {
+	for len(h.empty) <= level {
+		l := len(h.empty)
+		switch {
+		case l < leafLevel:
+			h.empty = append(h.empty, nil)
+		case l == leafLevel:
+			h.empty = append(h.empty, h.leafNode(0))
+		default:
+			child := h.empty[l-1]
+			h.empty = append(h.empty, h.joinNodes([8]*octNode{child, child, child, child, child, child, child, child}))
+		}
+	}
+	return h.empty[level]
+}
+
+// Generation returns how many generations the world has advanced.
+func (h *HashLife) Generation() int {
+	return h.generation
+}
+
+// half returns half the side of the root cube. The root covers -half to half-1 on each axis.
+func (h *HashLife) half() int {
+	return 1 << (h.root.level - 1)
+}
+
+// contains reports whether p lies inside the root cube.
+func (h *HashLife) contains(p Point) bool {
+	half := h.half()
+	return p.X >= -half && p.X < half && p.Y >= -half && p.Y < half && p.Z >= -half && p.Z < half
+}
+
+// Alive reports whether the cell at p is alive.
+func (h *HashLife) Alive(p Point) bool {
+	if !h.contains(p) {
+		return false
+	}
+	half := h.half()
+	n, x, y, z := h.root, p.X+half, p.Y+half, p.Z+half
+	for n.level > leafLevel {
+		if n.population == 0 {
+			return false
+		}
+		bit := n.level - 1
+		n = n.children[octant(x, y, z, bit)]
+		x, y, z = x&(1<<bit-1), y&(1<<bit-1), z&(1<<bit-1)
+	}
+	return n.leaf&leafBit(x, y, z) != 0
+}
+
+// State returns the state of the cell at p, which is StateAlive or StateDead.
+func (h *HashLife) State(p Point) int {
+	if h.Alive(p) {
+		return StateAlive
+	}
+	return StateDead
+}
+
+// Set makes the cell at p alive or dead. The root grows until it holds p.
+func (h *HashLife) Set(p Point, alive bool) {
+	for !h.contains(p) {
+		h.root = h.expand(h.root)
+	}
+	half := h.half()
+	h.root = h.setCell(h.root, p.X+half, p.Y+half, p.Z+half, alive)
+}
+
+// setCell returns the cube n with the cell at x, y, z, relative to its corner, changed.
+func (h *HashLife) setCell(n *octNode, x, y, z int, alive bool) *octNode {
+	if n.level == leafLevel {
+		if alive {
+			return h.leafNode(n.leaf | leafBit(x, y, z))
+		}
+		return h.leafNode(n.leaf &^ leafBit(x, y, z))
+	}
+	bit := n.level - 1
+	children := n.children
+	i := octant(x, y, z, bit)
+	children[i] = h.setCell(children[i], x&(1<<bit-1), y&(1<<bit-1), z&(1<<bit-1), alive)
+	return h.joinNodes(children)
+}
+
+// expand returns a cube twice the size of n with n at its center.
+func (h *HashLife) expand(n *octNode) *octNode {
+	empty := h.emptyNode(n.level - 1)
+	var children [8]*octNode
+	for i := range children {
+		var grandchildren [8]*octNode
+		for j := range grandchildren {
+			grandchildren[j] = empty
+		}
+		// The child in the opposite corner of the new child touches the center
+		grandchildren[7-i] = n.children[i]
+		children[i] = h.joinNodes(grandchildren)
+	}
+	return h.joinNodes(children)
+}
+
+// center returns the cube of half the size at the center of n.
+func (h *HashLife) center(n *octNode) *octNode {
+	if n.level == baseLevel {
+		var cells uint64
+		for x := 0; x < 4; x++ {
+			for y := 0; y < 4; y++ {
+				for z := 0; z < 4; z++ {
+					if cellOf(n, x+2, y+2, z+2) {
+						cells |= leafBit(x, y, z)
+					}
+				}
+			}
+		}
+		return h.leafNode(cells)
+	}
+	var children [8]*octNode
+	for i := range children {
+		children[i] = n.children[i].children[7-i]
+	}
+	return h.joinNodes(children)
+}
+
+// cellOf reports whether the cell at x, y, z, relative to the corner of n, is alive.
+func cellOf(n *octNode, x, y, z int) bool {
+	for n.level > leafLevel {
+		bit := n.level - 1
+		n = n.children[octant(x, y, z, bit)]
+		x, y, z = x&(1<<bit-1), y&(1<<bit-1), z&(1<<bit-1)
+	}
+	return n.leaf&leafBit(x, y, z) != 0
+}
+
+// grandchild returns the cube of a quarter of the size at position x, y, z (each 0 to 3) of
+// the 4x4x4 grandchildren of n.
+func grandchild(n *octNode, x, y, z int) *octNode {
+	return n.children[octant(x, y, z, 1)].children[octant(x, y, z, 0)]
+}
+
+// result returns the center of n, half its size, 2^step generations later. The step can
+// be at most n.level-2.
+func (h *HashLife) result(n *octNode, step int) *octNode {
+	if n.population == 0 {
+		return h.emptyNode(n.level - 1)
+	}
+	key := resultKey{n, step}
+	if r, ok := h.results[key]; ok {
+		return r
+	}
+
+	var r *octNode
+	if n.level == baseLevel {
+		r = h.baseResult(n, 1<<step)
+	} else {
+		// The 27 overlapping cubes of half the size, made of 2x2x2 grandchildren, give the
+		// state of the 3x3x3 grandchildren-sized cubes around the center, either half-way
+		// there or still at the start for shorter steps
+		var middle [3][3][3]*octNode
+		for x := 0; x < 3; x++ {
+			for y := 0; y < 3; y++ {
+				for z := 0; z < 3; z++ {
+					var children [8]*octNode
+					for i := range children {
+						children[i] = grandchild(n, x+i>>2, y+i>>1&1, z+i&1)
+					}
+					sub := h.joinNodes(children)
+					if step == n.level-2 {
+						middle[x][y][z] = h.result(sub, step-1)
+					} else {
+						middle[x][y][z] = h.center(sub)
+					}
+				}
+			}
+		}
+
+		// The 8 overlapping cubes made of 2x2x2 of those give the rest of the way
+		nextStep := step
+		if step == n.level-2 {
+			nextStep = step - 1
+		}
+		var children [8]*octNode
+		for i := range children {
+			x, y, z := i>>2, i>>1&1, i&1
+			var quarter [8]*octNode
+			for j := range quarter {
+				quarter[j] = middle[x+j>>2][y+j>>1&1][z+j&1]
+			}
+			children[i] = h.result(h.joinNodes(quarter), nextStep)
+		}
+		r = h.joinNodes(children)
+	}
+
+	h.results[key] = r
+	return r
+}
+
+// baseResult works out the center of an 8x8x8 cube one or two generations later cell by
+// cell. Each generation the cells that can still be worked out shrink by one on every side.
+func (h *HashLife) baseResult(n *octNode, generations int) *octNode {
+	var cells [8][8][8]bool
+	for x := 0; x < 8; x++ {
+		for y := 0; y < 8; y++ {
+			for z := 0; z < 8; z++ {
+				cells[x][y][z] = cellOf(n, x, y, z)
+			}
+		}
+	}
+
+	for g := 1; g <= generations; g++ {
+		var next [8][8][8]bool
+		for x := g; x < 8-g; x++ {
+			for y := g; y < 8-g; y++ {
+				for z := g; z < 8-g; z++ {
+					aliveNeighbors := 0
+					for _, offset := range h.offsets {
+						if cells[x+offset[0]][y+offset[1]][z+offset[2]] {
+							aliveNeighbors++
+						}
+					}
+					if cells[x][y][z] {
+						next[x][y][z] = h.rule.Survives(aliveNeighbors)
+					} else {
+						next[x][y][z] = h.rule.Born(aliveNeighbors)
+					}
+				}
+			}
+		}
+		cells = next
+	}
+
+	var leaf uint64
+	for x := 0; x < 4; x++ {
+		for y := 0; y < 4; y++ {
+			for z := 0; z < 4; z++ {
+				if cells[x+2][y+2][z+2] {
+					leaf |= leafBit(x, y, z)
+				}
+			}
+		}
+	}
+	return h.leafNode(leaf)
+}
+
+// Population returns the number of live cells.
+func (h *HashLife) Population() int {
+	return h.root.population
+}
+
+// LiveCells returns the coordinates of every live cell, in octree order.
+func (h *HashLife) LiveCells() []Point {
+	var points []Point
+	half := h.half()
+	var walk func(n *octNode, x, y, z int)
+	walk = func(n *octNode, x, y, z int) {
+		if n.population == 0 {
+			return
+		}
+		if n.level == leafLevel {
+			for i := 0; i < 64; i++ {
+				if n.leaf&(1<<i) != 0 {
+					points = append(points, Point{x + i>>4, y + i>>2&3, z + i&3})
+				}
+			}
+			return
+		}
+		side := 1 << (n.level - 1)
+		for i, child := range n.children {
+			walk(child, x+side*(i>>2), y+side*(i>>1&1), z+side*(i&1))
+		}
+	}
+	walk(h.root, -half, -half, -half)
+	return points
+}
+
+// Rule returns the rule the world runs.
+func (h *HashLife) Rule() Rule {
+	return h.rule
+}
+
+// SetRule changes the rule used for the following generations. Remembered results belong
+// to the old rule, so they are forgotten.
+func (h *HashLife) SetRule(r Rule) error {
+	if err := CheckHashLifeRule(r); err != nil {
+		return err
+	}
+	h.rule = r
+	h.offsets = r.Neighborhood.Offsets()
+	if h.results != nil {
+		h.results = make(map[resultKey]*octNode)
+	}
+	return nil
+}
+
+// Step advances the world one generation.
+func (h *HashLife) Step() {
+	h.StepN(1)
+}
+
+// StepN advances the world n generations. The jump is made in one power of two at a time,
+// so it takes time in proportion to the number of bits of n rather than to n.
+func (h *HashLife) StepN(n int) {
+	for step := 0; n > 0; step++ {
+		if n&1 != 0 {
+			h.stepPow2(step)
+		}
+		n >>= 1
+	}
+}
+
+// stepPow2 advances the world 2^step generations.
+func (h *HashLife) stepPow2(step int) {
+	// Cells move at most one cell a generation, so once all live cells are within the
+	// middle quarter of a root big enough for the step, they all stay inside its center
+	for h.root.level < max(step+3, baseLevel+1) || h.center(h.center(h.root)).population != h.root.population {
+		h.root = h.expand(h.root)
+	}
+	h.root = h.result(h.root, step)
+	h.generation += 1 << step
+
+	if len(h.nodes) > maxOctNodes {
+		h.collect()
+	}
+}
+
+// collect forgets the cubes and results that are no longer part of the world, keeping
+// memory in check on long runs.
+func (h *HashLife) collect() {
+	old := h.root
+	h.forget()
+	copied := make(map[*octNode]*octNode)
+	var intern func(n *octNode) *octNode
+	intern = func(n *octNode) *octNode {
+		if c, ok := copied[n]; ok {
+			return c
+		}
+		var c *octNode
+		if n.level == leafLevel {
+			c = h.leafNode(n.leaf)
+		} else {
+			var children [8]*octNode
+			for i, child := range n.children {
+				children[i] = intern(child)
+			}
+			c = h.joinNodes(children)
+		}
+		copied[n] = c
+		return c
+	}
+	h.root = intern(old)
+}
+
+// Jumper is a world that can advance many generations faster than stepping them one by one.
+type Jumper interface {
+	World
+	// StepN advances the world n generations.
+	StepN(n int)
+}
+
+// Advance steps w n generations. Jumpers, like HashLife, do it in one go, other worlds are
+// stepped one generation at a time.
+func Advance(w World, n int) {
+	if jumper, ok := w.(Jumper); ok {
+		jumper.StepN(n)
+		return
+	}
+	for i := 0; i < n; i++ {
+		w.Step()
+	}
+}
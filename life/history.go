@@ -0,0 +1,60 @@
+package life
+
+// History keeps snapshots of the last generations of a world so it can be stepped backwards.
+// It is a ring buffer: once it is full, every new snapshot pushes out the oldest one.
+type History struct {
+	snapshots []Snapshot
+	// index of the oldest snapshot and the number kept
+	start, count int
+}
+
+// NewHistory creates a history that keeps up to limit snapshots.
+func NewHistory(limit int) *History {
+	return &History{snapshots: make([]Snapshot, max(limit, 1))}
+}
+
+// Len returns the number of snapshots kept.
+func (h *History) Len() int {
+	return h.count
+}
+
+// Oldest returns the generation of the oldest snapshot kept, if there is one.
+func (h *History) Oldest() (generation int, ok bool) {
+	if h.count == 0 {
+		return 0, false
+	}
+	return h.snapshots[h.start].Generation, true
+}
+
+// Push keeps a snapshot as the newest one, pushing out the oldest if the history is full.
+func (h *History) Push(s Snapshot) {
+	if h.count == len(h.snapshots) {
+		h.snapshots[h.start] = Snapshot{}
+		h.start = (h.start + 1) % len(h.snapshots)
+		h.count--
+	}
+	h.snapshots[(h.start+h.count)%len(h.snapshots)] = s
+	h.count++
+}
+
+// Back drops the n newest snapshots and returns the last one dropped, the oldest of them. It
+// returns false if the history is empty. Asking for more snapshots than are kept goes back to
+// the oldest one.
+func (h *History) Back(n int) (Snapshot, bool) {
+	if h.count == 0 || n < 1 {
+		return Snapshot{}, false
+	}
+	var s Snapshot
+	for ; n > 0 && h.count > 0; n-- {
+		i := (h.start + h.count - 1) % len(h.snapshots)
+		s, h.snapshots[i] = h.snapshots[i], Snapshot{}
+		h.count--
+	}
+	return s, true
+}
+
+// Clear drops every snapshot, for when the world is replaced or changed by hand.
+func (h *History) Clear() {
+	clear(h.snapshots)
+	h.start, h.count = 0, 0
+}
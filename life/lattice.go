@@ -0,0 +1,156 @@
+package life
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Lattice is how the cells of a world are arranged in space. On the simple cubic lattice the
+// neighbors of a cell are given by the rule's neighborhood. On the close-packed lattices every
+// cell touches 12 others, all the same distance away, and those are its neighbors.
+//
+// The close-packed lattices are stacks of hexagonal layers along the y axis, stored in the same
+// x, y, z coordinates as the cubic one. Within a layer, each line of cells along z is shifted
+// half a cell when x is odd, so a box of cells still looks like a box. Layers are shifted
+// against each other so every cell sits in a hollow of the layer below.
+type Lattice int
+
+const (
+	// Cubic is the simple cubic lattice, with cells at whole coordinates
+	Cubic Lattice = iota
+	// FCC is the face-centered cubic lattice, hexagonal layers stacked ABCABC
+	FCC
+	// HCP is the hexagonal close-packed lattice, hexagonal layers stacked ABAB
+	HCP
+)
+
+var latticeNames = map[Lattice]string{
+	Cubic: "cubic",
+	FCC:   "fcc",
+	HCP:   "hcp",
+}
+
+// ParseLattice parses a lattice name: cubic, fcc or hcp.
+func ParseLattice(s string) (Lattice, error) {
+	text := strings.ToLower(strings.TrimSpace(s))
+	switch text {
+	case "", "sc", "simple":
+		return Cubic, nil
+	}
+	for l, name := range latticeNames {
+		if text == name {
+			return l, nil
+		}
+	}
+	return Cubic, fmt.Errorf("unknown lattice %q, use cubic, fcc or hcp", s)
+}
+
+// String returns the lattice's name.
+func (l Lattice) String() string {
+	return latticeNames[l]
+}
+
+// period returns after how many cells along x and y the arrangement of a lattice repeats.
+// It is the same along z for every lattice.
+func (l Lattice) period() (x, y int) {
+	switch l {
+	case FCC:
+		return 2, 3
+	case HCP:
+		return 2, 2
+	default:
+		return 1, 1
+	}
+}
+
+// class returns which of the repeating kinds of rows the row of cells at x, y is. Every cell
+// of a class has the same neighbor offsets.
+func (l Lattice) class(x, y int) int {
+	px, py := l.period()
+	return ((x%px+px)%px)*py + (y%py+py)%py
+}
+
+// classes returns the number of kinds of rows.
+func (l Lattice) classes() int {
+	px, py := l.period()
+	return px * py
+}
+
+// Position returns the center of the cell at p, in units of the distance between touching
+// cells.
+func (l Lattice) Position(p Point) [3]float64 {
+	if l == Cubic {
+		return [3]float64{float64(p.X), float64(p.Y), float64(p.Z)}
+	}
+
+	// Lines along z are one apart, and the lines of a layer sqrt(3)/2 apart along x with every
+	// other line shifted half a cell
+	rowSpacing := math.Sqrt(3) / 2
+	x := float64(p.X) * rowSpacing
+	z := float64(p.Z)
+	if (p.X%2+2)%2 == 1 {
+		z += 0.5
+	}
+
+	// Each layer type is shifted onto a hollow of the one before it, which lies a third of the
+	// way to the next line and half a cell along it
+	_, layers := l.period()
+	layer := float64((p.Y%layers + layers) % layers)
+	x += layer * rowSpacing / 3
+	z += layer * 0.5
+
+	y := float64(p.Y) * math.Sqrt(2.0/3.0)
+	return [3]float64{x, y, z}
+}
+
+// Neighbors returns how many neighbors each cell has on the lattice. The neighborhood only
+// matters on the cubic lattice.
+func (l Lattice) Neighbors(n Neighborhood) int {
+	return len(l.offsets(n)[0])
+}
+
+// offsets returns the neighbor offsets of each class of row. Cubic lattices use the
+// neighborhood, close-packed ones the 12 touching cells.
+func (l Lattice) offsets(n Neighborhood) [][][3]int {
+	if l == Cubic {
+		return [][][3]int{n.Offsets()}
+	}
+
+	px, py := l.period()
+	classes := make([][][3]int, l.classes())
+	for x := 0; x < px; x++ {
+		for y := 0; y < py; y++ {
+			center := l.Position(Point{x, y, 0})
+			var offsets [][3]int
+			for dx := -1; dx <= 1; dx++ {
+				for dy := -1; dy <= 1; dy++ {
+					for dz := -2; dz <= 2; dz++ {
+						other := l.Position(Point{x + dx, y + dy, dz})
+						distance := math.Sqrt(square(other[0]-center[0]) + square(other[1]-center[1]) + square(other[2]-center[2]))
+						if math.Abs(distance-1) < 1e-9 {
+							offsets = append(offsets, [3]int{dx, dy, dz})
+						}
+					}
+				}
+			}
+			classes[l.class(x, y)] = offsets
+		}
+	}
+	return classes
+}
+
+// reach returns how far any of the offsets reach along an axis.
+func reach(classes [][][3]int) int {
+	r := 0
+	for _, offsets := range classes {
+		for _, offset := range offsets {
+			r = max(r, abs(offset[0]), abs(offset[1]), abs(offset[2]))
+		}
+	}
+	return r
+}
+
+func square(v float64) float64 {
+	return v * v
+}
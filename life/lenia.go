@@ -0,0 +1,309 @@
+package life
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// LeniaParams are the settings of a Lenia world.
+type LeniaParams struct {
+	// Radius of the kernel in cells
+	Radius int
+	// Center and width of the growth function. Cells whose weighted neighborhood is close to
+	// Mu grow, the others shrink
+	Mu, Sigma float64
+	// How much of the growth is applied each generation
+	Dt float64
+}
+
+// DefaultLeniaParams grow blobs that drift and split in a pillar of the default size.
+var DefaultLeniaParams = LeniaParams{Radius: 3, Mu: 0.2, Sigma: 0.03, Dt: 0.1}
+
+// ParseLeniaParams parses settings like "mu=0.2,sigma=0.03,radius=3,dt=0.1". Settings that
+// aren't given keep their default.
+func ParseLeniaParams(s string) (LeniaParams, error) {
+	p := DefaultLeniaParams
+	text := strings.ToLower(strings.TrimSpace(s))
+	if text == "" {
+		return p, nil
+	}
+	for _, item := range strings.Split(text, ",") {
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			return p, fmt.Errorf("lenia setting %q must look like name=value", item)
+		}
+		var err error
+		switch strings.TrimSpace(name) {
+		case "mu", "m":
+			p.Mu, err = strconv.ParseFloat(strings.TrimSpace(value), 64)
+		case "sigma", "s":
+			p.Sigma, err = strconv.ParseFloat(strings.TrimSpace(value), 64)
+		case "dt", "t":
+			p.Dt, err = strconv.ParseFloat(strings.TrimSpace(value), 64)
+		case "radius", "r":
+			p.Radius, err = strconv.Atoi(strings.TrimSpace(value))
+		default:
+			return p, fmt.Errorf("unknown lenia setting %q, use mu, sigma, radius or dt", name)
+		}
+		if err != nil {
+			return p, fmt.Errorf("lenia setting %s: %q is not a number", name, value)
+		}
+	}
+	return p, p.Check()
+}
+
+// Check reports settings that can't run.
+func (p LeniaParams) Check() error {
+	// The kernel's shell lies strictly between the center and the radius, so a radius of 1
+	// leaves no cell in it to weigh
+	if p.Radius < 2 {
+		return fmt.Errorf("lenia radius must be at least 2, got %d", p.Radius)
+	}
+	if math.IsNaN(p.Mu) || math.IsInf(p.Mu, 0) {
+		return fmt.Errorf("lenia mu must be a number, got %g", p.Mu)
+	}
+	if !(p.Sigma > 0) || math.IsInf(p.Sigma, 0) {
+		return fmt.Errorf("lenia sigma must be positive, got %g", p.Sigma)
+	}
+	if !(p.Dt > 0 && p.Dt <= 1) {
+		return fmt.Errorf("lenia dt must be above 0 and at most 1, got %g", p.Dt)
+	}
+	return nil
+}
+
+// String returns the settings in the form ParseLeniaParams reads.
+func (p LeniaParams) String() string {
+	return fmt.Sprintf("mu=%g,sigma=%g,radius=%d,dt=%g", p.Mu, p.Sigma, p.Radius, p.Dt)
+}
+
+// LeniaAlive is the value from which a Lenia cell counts as alive.
+const LeniaAlive = 0.5
+
+// Continuous is a world whose cells hold a value from 0 to 1 rather than just a state.
+type Continuous interface {
+	World
+	// Value returns the value of the cell at p.
+	Value(p Point) float64
+}
+
+// Lenia is a continuous world in the style of Lenia and SmoothLife. Every cell holds a value
+// from 0 to 1. Each generation the values around a cell are weighed by a kernel shaped like a
+// soft spherical shell, and the cell grows or shrinks depending on how close that weighted sum
+// is to Mu. The box wraps around on every axis.
+//
+// The kernel covers thousands of cells at moderate radii, so the weighted sums are worked out
+// for all cells at once as a product in Fourier space.
+type Lenia struct {
+	size   Size
+	params LeniaParams
+	values []float64
+	// the transformed kernel, and scratch space for the transformed values
+	kernel     []complex128
+	spectrum   []complex128
+	fft        *fft3
+	generation int
+}
+
+// NewLenia creates an empty Lenia world. It panics if any side of the box is smaller than one
+// cell, and fails for settings that can't run.
+func NewLenia(size Size, params LeniaParams) (*Lenia, error) {
+	if size.X < 1 || size.Y < 1 || size.Z < 1 {
+		panic(fmt.Sprintf("life: lenia size %dx%dx%d must be at least 1x1x1", size.X, size.Y, size.Z))
+	}
+	l := &Lenia{
+		size:     size,
+		values:   make([]float64, size.Cells()),
+		spectrum: make([]complex128, size.Cells()),
+		fft:      newFFT3(size, runtime.GOMAXPROCS(0)),
+	}
+	if err := l.SetParams(params); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Size returns the size of the world's box.
+func (l *Lenia) Size() Size {
+	return l.size
+}
+
+// index returns where the cell at p is stored, wrapping p into the box.
+func (l *Lenia) index(p Point) int {
+	x := ((p.X % l.size.X) + l.size.X) % l.size.X
+	y := ((p.Y % l.size.Y) + l.size.Y) % l.size.Y
+	z := ((p.Z % l.size.Z) + l.size.Z) % l.size.Z
+	return (x*l.size.Y+y)*l.size.Z + z
+}
+
+// contains reports whether p lies inside the box.
+func (l *Lenia) contains(p Point) bool {
+	return p.X >= 0 && p.X < l.size.X && p.Y >= 0 && p.Y < l.size.Y && p.Z >= 0 && p.Z < l.size.Z
+}
+
+// Params returns the world's settings.
+func (l *Lenia) Params() LeniaParams {
+	return l.params
+}
+
+// SetParams changes the settings used for the following generations.
+func (l *Lenia) SetParams(p LeniaParams) error {
+	if err := p.Check(); err != nil {
+		return err
+	}
+	if p.Radius != l.params.Radius || l.kernel == nil {
+		l.kernel = l.buildKernel(p.Radius)
+	}
+	l.params = p
+	return nil
+}
+
+// buildKernel returns the transform of a shell kernel of the given radius, laid out around
+// the origin of the box and wrapping around its faces. The weights add up to one.
+func (l *Lenia) buildKernel(radius int) []complex128 {
+	kernel := make([]complex128, l.size.Cells())
+	total := 0.0
+	for dx := -radius; dx <= radius; dx++ {
+		for dy := -radius; dy <= radius; dy++ {
+			for dz := -radius; dz <= radius; dz++ {
+				r := math.Sqrt(float64(dx*dx+dy*dy+dz*dz)) / float64(radius)
+				if r <= 0 || r >= 1 {
+					continue
+				}
+				// A smooth bump that peaks half way out, so the kernel is a soft shell
+				weight := math.Exp(4 - 1/(r*(1-r)))
+				kernel[l.index(Point{dx, dy, dz})] += complex(weight, 0)
+				total += weight
+			}
+		}
+	}
+	for i := range kernel {
+		kernel[i] /= complex(total, 0)
+	}
+	l.fft.transform(kernel, false)
+	return kernel
+}
+
+// growth returns how much a cell grows with the weighted sum u of its neighborhood, from -1
+// to 1.
+func (p LeniaParams) growth(u float64) float64 {
+	d := (u - p.Mu) / p.Sigma
+	return 2*math.Exp(-d*d/2) - 1
+}
+
+// Step advances the world one generation.
+func (l *Lenia) Step() {
+	for i, v := range l.values {
+		l.spectrum[i] = complex(v, 0)
+	}
+	l.fft.transform(l.spectrum, false)
+	for i := range l.spectrum {
+		l.spectrum[i] *= l.kernel[i]
+	}
+	l.fft.transform(l.spectrum, true)
+
+	for i, v := range l.values {
+		v += l.params.Dt * l.params.growth(real(l.spectrum[i]))
+		l.values[i] = min(max(v, 0), 1)
+	}
+	l.generation++
+}
+
+// Generation returns how many generations the world has advanced.
+func (l *Lenia) Generation() int {
+	return l.generation
+}
+
+// Value returns the value of the cell at p, from 0 to 1. Cells outside the box are 0.
+func (l *Lenia) Value(p Point) float64 {
+	if !l.contains(p) {
+		return 0
+	}
+	return l.values[l.index(p)]
+}
+
+// SetValue sets the value of the cell at p, clamped to 0 to 1. Cells outside the box are
+// ignored.
+func (l *Lenia) SetValue(p Point, v float64) {
+	if l.contains(p) {
+		l.values[l.index(p)] = min(max(v, 0), 1)
+	}
+}
+
+// Alive reports whether the cell at p has a value of at least LeniaAlive.
+func (l *Lenia) Alive(p Point) bool {
+	return l.Value(p) >= LeniaAlive
+}
+
+// State returns StateAlive for alive cells and StateDead for the others.
+func (l *Lenia) State(p Point) int {
+	if l.Alive(p) {
+		return StateAlive
+	}
+	return StateDead
+}
+
+// Set sets the value of the cell at p to 1 or 0.
+func (l *Lenia) Set(p Point, alive bool) {
+	if alive {
+		l.SetValue(p, 1)
+	} else {
+		l.SetValue(p, 0)
+	}
+}
+
+// Population returns the number of alive cells.
+func (l *Lenia) Population() int {
+	population := 0
+	for _, v := range l.values {
+		if v >= LeniaAlive {
+			population++
+		}
+	}
+	return population
+}
+
+// LiveCells returns the coordinates of every alive cell, ordered by x, then y, then z.
+func (l *Lenia) LiveCells() []Point {
+	var points []Point
+	for x := 0; x < l.size.X; x++ {
+		for y := 0; y < l.size.Y; y++ {
+			for z := 0; z < l.size.Z; z++ {
+				if l.values[(x*l.size.Y+y)*l.size.Z+z] >= LeniaAlive {
+					points = append(points, Point{x, y, z})
+				}
+			}
+		}
+	}
+	return points
+}
+
+// Rule returns the zero rule. Lenia is driven by its params instead.
+func (l *Lenia) Rule() Rule {
+	return Rule{}
+}
+
+// SetRule fails, since Lenia doesn't run B/S rules.
+func (l *Lenia) SetRule(r Rule) error {
+	return fmt.Errorf("lenia doesn't run B/S rules, change mu and sigma instead")
+}
+
+// FillRandom gives each cell in the box from the origin to size a random value with the given
+// probability, like the package level FillRandom does with alive cells.
+func (l *Lenia) FillRandom(size Size, density float32, seed int64) {
+	rnd := rand.New(rand.NewSource(seed))
+	for x := 0; x < size.X; x++ {
+		for y := 0; y < size.Y; y++ {
+			for z := 0; z < size.Z; z++ {
+				v := 0.0
+				if rnd.Float32() < density {
+					v = rnd.Float64()
+				}
+				l.SetValue(Point{x, y, z}, v)
+			}
+		}
+	}
+}
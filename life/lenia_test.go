@@ -0,0 +1,28 @@
+package life
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLeniaRadius(t *testing.T) {
+	if _, err := NewLenia(Size{X: 8, Y: 8, Z: 8}, LeniaParams{Radius: 1, Mu: 0.2, Sigma: 0.03, Dt: 0.1}); err == nil {
+		t.Error("radius 1 was accepted, but its kernel has no cells")
+	}
+	// Every radius that is accepted weighs some cells, so the values stay numbers
+	for radius := 2; radius <= 5; radius++ {
+		params := DefaultLeniaParams
+		params.Radius = radius
+		l, err := NewLenia(Size{X: 12, Y: 12, Z: 12}, params)
+		if err != nil {
+			t.Fatalf("radius %d: %v", radius, err)
+		}
+		l.FillRandom(l.Size(), 0.5, 3)
+		l.Step()
+		for i, v := range l.values {
+			if math.IsNaN(v) || v < 0 || v > 1 {
+				t.Fatalf("radius %d: cell %d has value %g after a step", radius, i, v)
+			}
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package life
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// NeighborhoodKind is the shape of the block of cells around a cell that count as its neighbors.
+type NeighborhoodKind int
+
+const (
+	// Moore is the full cube around a cell: 26 neighbors at radius 1.
+	Moore NeighborhoodKind = iota
+	// FaceEdge is the cube without its corners: the 18 cells sharing a face or an edge at radius 1.
+	FaceEdge
+	// VonNeumann is the octahedron of cells within Manhattan distance R: 6 face neighbors at radius 1.
+	VonNeumann
+)
+
+// maxRadius is the largest neighborhood radius a rule can use.
+const maxRadius = 4
+
+// neighborhoodLetters are the letters used for each kind in rule notation, e.g. B5-7/S4-9/NV2.
+var neighborhoodLetters = map[NeighborhoodKind]byte{
+	Moore:      'M',
+	FaceEdge:   'E',
+	VonNeumann: 'V',
+}
+
+// Neighborhood is a neighborhood shape at a given radius, like Larger than Life's extended
+// Moore and von Neumann neighborhoods.
+type Neighborhood struct {
+	Kind   NeighborhoodKind
+	Radius int
+}
+
+// MooreNeighborhood is the 26 cell neighborhood rules count over unless they pick another one.
+var MooreNeighborhood = Neighborhood{Kind: Moore, Radius: 1}
+
+// contains reports whether the cell at the offset from the center is a neighbor.
+func (n Neighborhood) contains(dx, dy, dz int) bool {
+	if dx == 0 && dy == 0 && dz == 0 {
+		return false
+	}
+	ax, ay, az := abs(dx), abs(dy), abs(dz)
+	if max(ax, ay, az) > n.Radius {
+		return false
+	}
+	switch n.Kind {
+	case FaceEdge:
+		// Drop the cells closest to the corners of the cube
+		return ax+ay+az <= 2*n.Radius
+	case VonNeumann:
+		return ax+ay+az <= n.Radius
+	}
+	return true
+}
+
+// Offsets returns the relative coordinates of every neighbor of a cell.
+func (n Neighborhood) Offsets() [][3]int {
+	var offsets [][3]int
+	for dx := -n.Radius; dx <= n.Radius; dx++ {
+		for dy := -n.Radius; dy <= n.Radius; dy++ {
+			for dz := -n.Radius; dz <= n.Radius; dz++ {
+				if n.contains(dx, dy, dz) {
+					offsets = append(offsets, [3]int{dx, dy, dz})
+				}
+			}
+		}
+	}
+	return offsets
+}
+
+// Size returns how many neighbors a cell has.
+func (n Neighborhood) Size() int {
+	return len(n.Offsets())
+}
+
+// String returns the neighborhood in rule notation. The radius is left out when it is 1.
+func (n Neighborhood) String() string {
+	s := "N" + string(neighborhoodLetters[n.Kind])
+	if n.Radius != 1 {
+		s += strconv.Itoa(n.Radius)
+	}
+	return s
+}
+
+// Name returns a human readable description of the neighborhood, like "moore r1 (26)".
+func (n Neighborhood) Name() string {
+	names := map[NeighborhoodKind]string{
+		Moore:      "moore",
+		FaceEdge:   "face+edge",
+		VonNeumann: "von neumann",
+	}
+	return fmt.Sprintf("%s r%d (%d)", names[n.Kind], n.Radius, n.Size())
+}
+
+// parseNeighborhood parses the neighborhood part of a rule, e.g. "NM", "NV2" or "N18".
+func parseNeighborhood(text string) (Neighborhood, error) {
+	switch text {
+	case "N26":
+		return Neighborhood{Kind: Moore, Radius: 1}, nil
+	case "N18":
+		return Neighborhood{Kind: FaceEdge, Radius: 1}, nil
+	case "N6":
+		return Neighborhood{Kind: VonNeumann, Radius: 1}, nil
+	}
+
+	if len(text) < 2 || text[0] != 'N' {
+		return Neighborhood{}, fmt.Errorf("neighborhood %q must look like NM, NE, NV or NM2", text)
+	}
+	n := Neighborhood{Radius: 1}
+	found := false
+	for kind, letter := range neighborhoodLetters {
+		if text[1] == letter {
+			n.Kind = kind
+			found = true
+		}
+	}
+	if !found {
+		return Neighborhood{}, fmt.Errorf("unknown neighborhood %q, use M (moore), E (face+edge) or V (von neumann)", text[1:2])
+	}
+	if len(text) > 2 {
+		radius, err := strconv.Atoi(text[2:])
+		if err != nil || radius < 1 || radius > maxRadius {
+			return Neighborhood{}, fmt.Errorf("neighborhood radius %q must be between 1 and %d", text[2:], maxRadius)
+		}
+		n.Radius = radius
+	}
+	return n, nil
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
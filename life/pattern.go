@@ -0,0 +1,310 @@
+package life
+
+import (
+	"bufio"
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//go:embed patterns/*.rle3
+var patternFiles embed.FS
+
+// PatternExt is the file extension of patterns, and of the patterns in the library.
+const PatternExt = ".rle3"
+
+// maxPatternSide is the longest a pattern can be along any axis.
+const maxPatternSide = 4096
+
+// Pattern is a 3D arrangement of live cells, read from the layered run length encoding of
+// ParsePattern.
+type Pattern struct {
+	// Name the pattern gives itself, and the comments that describe it
+	Name     string
+	Comments []string
+	// Size of the box the pattern fills from the origin
+	Size Size
+	// Rule the pattern runs under, empty if it doesn't say
+	Rule string
+	// Cells that are alive, in the order they were read
+	Cells []Point
+}
+
+// ParsePattern reads a pattern in a 3D take on the run length encoding 2D Life patterns are
+// shared in:
+//
+//	#N bays-glider
+//	#C Bays' glider, moving one cell every 4 generations
+//	x = 3, y = 4, z = 2, rule = 4555
+//	bo$2bo$2bo$bo/bo$obo$obo$bo!
+//
+// Lines starting with # are comments, #N naming the pattern. The header gives the size of the
+// pattern and optionally its rule. Then b (or .) is a dead cell and o a live one, $ ends a row
+// and / ends a layer, and ! ends the pattern. Any of them can follow a count that repeats them.
+// Cells go along x, rows along y and layers along z. Cells left out at the end of rows, rows at
+// the end of layers and layers at the end of the pattern are dead.
+//
+// The .rle3 files Golly's 3D.lua saves read too. Their first line, like "3D version=1 size=30
+// pos=0,0,0", is skipped, and their rules, like 3D4,5/5, are turned into the notation ParseRule
+// reads.
+func ParsePattern(r io.Reader) (Pattern, error) {
+	var p Pattern
+	scanner := bufio.NewScanner(r)
+	line := 0
+	header := false
+	// where the next cell goes, and the count waiting for its tag
+	var x, y, z int
+	count := ""
+	done := false
+	for scanner.Scan() && !done {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(text, "#") {
+			if !header {
+				p.comment(text)
+			}
+			continue
+		}
+		if text == "" {
+			continue
+		}
+		if !header && (text == "3D" || strings.HasPrefix(text, "3D ")) {
+			if err := checkGollyLine(text); err != nil {
+				return p, fmt.Errorf("pattern line %d: %w", line, err)
+			}
+			continue
+		}
+		if !header {
+			if err := p.parseHeader(text); err != nil {
+				return p, fmt.Errorf("pattern line %d: %w", line, err)
+			}
+			header = true
+			continue
+		}
+
+		for column, c := range text {
+			fail := func(format string, args ...any) error {
+				return fmt.Errorf("pattern line %d, column %d: %s", line, column+1, fmt.Sprintf(format, args...))
+			}
+			if c >= '0' && c <= '9' {
+				if len(count) >= 9 {
+					return p, fail("count %s%c is too long", count, c)
+				}
+				count += string(c)
+				continue
+			}
+			if unicode.IsSpace(c) {
+				if count != "" {
+					return p, fail("count %s must come right before what it repeats", count)
+				}
+				continue
+			}
+			n := 1
+			if count != "" {
+				n, _ = strconv.Atoi(count)
+				if n == 0 {
+					return p, fail("count can't be 0")
+				}
+				count = ""
+			}
+			switch c {
+			case 'b', '.', 'o':
+				// Rows, layers and dead cells past the end only matter once a cell lands there
+				switch {
+				case x+n > p.Size.X:
+					return p, fail("row %d of layer %d is longer than the pattern's width %d", y+1, z+1, p.Size.X)
+				case c == 'o' && y >= p.Size.Y:
+					return p, fail("layer %d has more rows than the pattern's height %d", z+1, p.Size.Y)
+				case c == 'o' && z >= p.Size.Z:
+					return p, fail("pattern has more layers than its depth %d", p.Size.Z)
+				}
+				for i := 0; c == 'o' && i < n; i++ {
+					p.Cells = append(p.Cells, Point{x + i, y, z})
+				}
+				x += n
+			case '$':
+				x, y = 0, y+n
+			case '/':
+				x, y, z = 0, 0, z+n
+			case '!':
+				done = true
+			default:
+				return p, fail("unexpected %q, cells are b, . or o, rows end with $, layers with / and the pattern with !", c)
+			}
+			if done {
+				break
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return p, err
+	}
+	switch {
+	case !header:
+		return p, fmt.Errorf("pattern has no header like x = 3, y = 3, z = 2")
+	case !done:
+		return p, fmt.Errorf("pattern line %d: pattern doesn't end with !", line)
+	case count != "":
+		return p, fmt.Errorf("pattern line %d: count %s doesn't repeat anything", line, count)
+	}
+	return p, nil
+}
+
+// comment keeps a comment line before the header, taking the name from #N.
+func (p *Pattern) comment(text string) {
+	text = strings.TrimPrefix(text, "#")
+	if name, ok := strings.CutPrefix(text, "N"); ok && p.Name == "" {
+		p.Name = strings.TrimSpace(name)
+		return
+	}
+	// The kind of comment, like #C or #O, doesn't matter
+	if len(text) > 0 && unicode.IsUpper(rune(text[0])) {
+		text = text[1:]
+	}
+	p.Comments = append(p.Comments, strings.TrimSpace(text))
+}
+
+// checkGollyLine checks the line Golly's 3D.lua starts its files with, like "3D version=1
+// size=30 pos=0,0,0". Only the version matters, since the pattern is placed by the caller.
+func checkGollyLine(text string) error {
+	for _, item := range strings.Fields(text)[1:] {
+		if version, ok := strings.CutPrefix(item, "version="); ok && version != "1" {
+			return fmt.Errorf("Golly 3D version %s isn't supported, only version 1", version)
+		}
+	}
+	return nil
+}
+
+// headerEquals matches the equals signs of a header with the spaces around them.
+var headerEquals = regexp.MustCompile(`\s*=\s*`)
+
+// parseHeader reads the size and rule of a header like "x = 3, y = 3, z = 2, rule = 4555", or
+// like Golly's "x=3 y=3 z=2 rule=3D4,5/5".
+func (p *Pattern) parseHeader(text string) error {
+	// Parts are separated by commas or spaces. Rules can hold commas of their own, so pieces
+	// without an equals sign after the rule go back onto it.
+	var items []string
+	pieces := strings.FieldsFunc(headerEquals.ReplaceAllString(text, "="), func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+	for _, piece := range pieces {
+		if n := len(items); n > 0 && !strings.Contains(piece, "=") && strings.HasPrefix(strings.ToLower(items[n-1]), "rule=") {
+			items[n-1] += "," + piece
+		} else {
+			items = append(items, piece)
+		}
+	}
+
+	given := map[string]bool{}
+	for _, item := range items {
+		key, value, ok := strings.Cut(item, "=")
+		key, value = strings.ToLower(key), strings.TrimSpace(value)
+		if !ok {
+			return fmt.Errorf("header part %q must look like name = value", item)
+		}
+		if given[key] {
+			return fmt.Errorf("header gives %s twice", key)
+		}
+		given[key] = true
+		switch key {
+		case "x", "y", "z":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 || n > maxPatternSide {
+				return fmt.Errorf("header %s must be a whole number from 1 to %d, got %q", key, maxPatternSide, value)
+			}
+			switch key {
+			case "x":
+				p.Size.X = n
+			case "y":
+				p.Size.Y = n
+			case "z":
+				p.Size.Z = n
+			}
+		case "rule":
+			rule, err := gollyRule(value)
+			if err == nil {
+				_, err = ParseRule(rule)
+			}
+			if err != nil {
+				return fmt.Errorf("header rule: %w", err)
+			}
+			p.Rule = rule
+		default:
+			return fmt.Errorf("unknown header part %q, want x, y, z and rule", key)
+		}
+	}
+	if !given["x"] || !given["y"] || !given["z"] {
+		return fmt.Errorf("header must give the size like x = 3, y = 3, z = 2, got %q", text)
+	}
+	return nil
+}
+
+// gollyRule turns a rule in the notation of Golly's 3D.lua, like 3D4,5/5 (survival counts, then
+// birth counts) or 3DB5/S4..5F, into the notation ParseRule reads. Other rules are returned as
+// they are.
+func gollyRule(text string) (string, error) {
+	rest, ok := strings.CutPrefix(strings.ToUpper(text), "3D")
+	if !ok {
+		return text, nil
+	}
+	rest = strings.ReplaceAll(rest, "..", "-")
+	neighborhood := ""
+	if n := len(rest); n > 0 {
+		switch rest[n-1] {
+		case 'M':
+			rest = rest[:n-1]
+		case 'F':
+			rest, neighborhood = rest[:n-1], "/NV"
+		case 'C', 'E', 'H':
+			return "", fmt.Errorf("rule %q: Golly's corner, edge and hexahedral neighborhoods aren't supported", text)
+		}
+	}
+	if strings.ContainsAny(rest, "BS") {
+		return rest + neighborhood, nil
+	}
+	survival, birth, ok := strings.Cut(rest, "/")
+	if !ok {
+		return "", fmt.Errorf("rule %q must give survival and birth counts like 3D4,5/5", text)
+	}
+	return "B" + birth + "/S" + survival + neighborhood, nil
+}
+
+// Place makes the pattern's cells alive with its origin at the given point. Cells around them
+// are left as they are.
+func (p Pattern) Place(w World, at Point) {
+	for _, c := range p.Cells {
+		w.Set(Point{at.X + c.X, at.Y + c.Y, at.Z + c.Z}, true)
+	}
+}
+
+// PatternNames returns the names of the patterns in the library, in order.
+func PatternNames() []string {
+	entries, _ := fs.ReadDir(patternFiles, "patterns")
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, strings.TrimSuffix(entry.Name(), PatternExt))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LibraryPattern returns a pattern from the library by name.
+func LibraryPattern(name string) (Pattern, error) {
+	file, err := patternFiles.Open(path.Join("patterns", name+PatternExt))
+	if err != nil {
+		return Pattern{}, fmt.Errorf("no pattern named %q, the library has %s", name, strings.Join(PatternNames(), ", "))
+	}
+	defer file.Close()
+	p, err := ParsePattern(file)
+	if err != nil {
+		return p, fmt.Errorf("%s: %w", name, err)
+	}
+	return p, nil
+}
@@ -0,0 +1,152 @@
+package life
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestParsePatternErrors(t *testing.T) {
+	tests := []struct {
+		name, pattern, want string
+	}{
+		{"over-wide row", "x = 3, y = 2, z = 1\n2o$4o!", "pattern line 2, column 5: row 2 of layer 1 is longer than the pattern's width 3"},
+		{"over-wide dead cells", "x = 3, y = 2, z = 1\n4b!", "pattern line 2, column 2: row 1 of layer 1 is longer than the pattern's width 3"},
+		{"too many rows", "x = 2, y = 2, z = 1\no$o$o!", "pattern line 2, column 5: layer 1 has more rows than the pattern's height 2"},
+		{"too many layers", "x = 2, y = 1, z = 2\no/o/o!", "pattern line 2, column 5: pattern has more layers than its depth 2"},
+		{"missing !", "x = 2, y = 1, z = 1\n2o\n", "pattern line 2: pattern doesn't end with !"},
+		{"zero count", "x = 2, y = 1, z = 1\n0o!", "pattern line 2, column 2: count can't be 0"},
+		{"huge count", "x = 2, y = 1, z = 1\n1234567890o!", "pattern line 2, column 10: count 1234567890 is too long"},
+		{"huge run", "x = 2, y = 1, z = 1\n999999999o!", "pattern line 2, column 10: row 1 of layer 1 is longer than the pattern's width 2"},
+		{"count split by a space", "x = 2, y = 1, z = 1\n2 o!", "pattern line 2, column 2: count 2 must come right before what it repeats"},
+		{"count at the end", "x = 2, y = 1, z = 1\no!\n", ""},
+		{"unexpected character", "x = 2, y = 1, z = 1\noq!", "pattern line 2, column 2: unexpected 'q', cells are b, . or o, rows end with $, layers with / and the pattern with !"},
+		{"no header", "#N nothing\n", "pattern has no header like x = 3, y = 3, z = 2"},
+		{"header without a size", "x = 2, y = 1\no!", `pattern line 1: header must give the size like x = 3, y = 3, z = 2, got "x = 2, y = 1"`},
+		{"header with a zero side", "x = 0, y = 1, z = 1\no!", `pattern line 1: header x must be a whole number from 1 to 4096, got "0"`},
+		{"header with a huge side", "x = 5000, y = 1, z = 1\no!", `pattern line 1: header x must be a whole number from 1 to 4096, got "5000"`},
+		{"header with a side twice", "x = 2, x = 2, y = 1, z = 1\no!", "pattern line 1: header gives x twice"},
+		{"header with an unknown part", "x = 2, y = 1, z = 1, w = 4\no!", `pattern line 1: unknown header part "w", want x, y, z and rule`},
+		{"header part without a value", "x = 2, y = 1, z\no!", `pattern line 1: header part "z" must look like name = value`},
+		{"header with a bad rule", "x = 2, y = 1, z = 1, rule = B27/S\no!", `pattern line 1: header rule: rule "B27/S": birth count 27 is more than the 26 neighbors a cell has (separate counts with commas, like S4,5)`},
+		{"Golly rule without births", "x=2 y=1 z=1 rule=3D4,5\no!", `pattern line 1: header rule: rule "3D4,5" must give survival and birth counts like 3D4,5/5`},
+		{"Golly neighborhood", "x=2 y=1 z=1 rule=3D4/5C\no!", `pattern line 1: header rule: rule "3D4/5C": Golly's corner, edge and hexahedral neighborhoods aren't supported`},
+		{"Golly version", "3D version=2 size=30\nx=2 y=1 z=1\no!", "pattern line 1: Golly 3D version 2 isn't supported, only version 1"},
+	}
+	for _, test := range tests {
+		_, err := ParsePattern(strings.NewReader(test.pattern))
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != test.want {
+			t.Errorf("%s: got error %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParsePattern(t *testing.T) {
+	// Bays' glider as this package writes it and as Golly's 3D.lua saves it
+	patterns := []string{
+		"#N bays-glider\n#C moves every 4 generations\nx = 3, y = 4, z = 2, rule = 4555\nbo$2bo$2bo$bo/bo$obo$obo$bo!\n",
+		"3D version=1 size=30 pos=13,13,13 gens=0\n#N bays-glider\n#C moves every 4 generations\nx=3 y=4 z=2 rule=3D4,5/5\nbo$2bo$\n2bo$bo/bo$obo$obo$bo!\n",
+	}
+	want := []Point{{1, 0, 0}, {2, 1, 0}, {2, 2, 0}, {1, 3, 0}, {1, 0, 1}, {0, 1, 1}, {2, 1, 1}, {0, 2, 1}, {2, 2, 1}, {1, 3, 1}}
+	for _, text := range patterns {
+		p, err := ParsePattern(strings.NewReader(text))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Name != "bays-glider" || len(p.Comments) != 1 || p.Comments[0] != "moves every 4 generations" {
+			t.Errorf("name %q and comments %q", p.Name, p.Comments)
+		}
+		if p.Size != (Size{X: 3, Y: 4, Z: 2}) || !MustParseRule(p.Rule).Equal(MustParseRule("4555")) {
+			t.Errorf("size %v and rule %q, want 3x4x2 and 4555", p.Size, p.Rule)
+		}
+		if len(p.Cells) != len(want) {
+			t.Fatalf("%d cells, want %d", len(p.Cells), len(want))
+		}
+		for i, c := range p.Cells {
+			if c != want[i] {
+				t.Errorf("cell %d is %v, want %v", i, c, want[i])
+			}
+		}
+	}
+
+	rules := map[string]string{
+		"3D5,6,7/6":  "B6/S5-7",
+		"3D4..5/5F":  "B5/S4-5/NV",
+		"3D/3M":      "B3/S",
+		"3DB5/S4,5":  "B5/S4-5",
+		"B5-7/S4-9":  "B5-7/S4-9",
+		"5766":       "B6/S5-7",
+		"B5,6/S4..5": "",
+	}
+	for golly, want := range rules {
+		p, err := ParsePattern(strings.NewReader("x=1 y=1 z=1 rule=" + golly + "\no!"))
+		if want == "" {
+			if err == nil {
+				t.Errorf("rule %s read as %s, want an error", golly, p.Rule)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("rule %s: %v", golly, err)
+		} else if !MustParseRule(p.Rule).Equal(MustParseRule(want)) {
+			t.Errorf("rule %s read as %s, want %s", golly, p.Rule, want)
+		}
+	}
+}
+
+func TestLibraryPatterns(t *testing.T) {
+	names := PatternNames()
+	if len(names) == 0 {
+		t.Fatal("the library is empty")
+	}
+	for _, name := range names {
+		p, err := LibraryPattern(name)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if p.Name != name || p.Rule == "" || len(p.Cells) == 0 {
+			t.Errorf("%s: named %q with rule %q and %d cells", name, p.Name, p.Rule, len(p.Cells))
+		}
+	}
+	if _, err := LibraryPattern("no-such-pattern"); err == nil {
+		t.Error("a pattern that isn't in the library was found")
+	}
+}
+
+func FuzzParsePattern(f *testing.F) {
+	paths, _ := fs.Glob(patternFiles, path.Join("patterns", "*"+PatternExt))
+	for _, name := range paths {
+		data, err := fs.ReadFile(patternFiles, name)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(string(data))
+	}
+	f.Add("3D version=1 size=30 pos=0,0,0\nx=3 y=4 z=2 rule=3D4,5/5\nbo$2bo$2bo$bo/bo$obo$obo$bo!\n")
+	f.Fuzz(func(t *testing.T, text string) {
+		p, err := ParsePattern(strings.NewReader(text))
+		if err != nil {
+			return
+		}
+		// Whatever reads has a size it fits in and a rule that parses
+		if p.Size.X < 1 || p.Size.Y < 1 || p.Size.Z < 1 || p.Size.X > maxPatternSide || p.Size.Y > maxPatternSide || p.Size.Z > maxPatternSide {
+			t.Fatalf("pattern read with size %v", p.Size)
+		}
+		for _, c := range p.Cells {
+			if c.X < 0 || c.Y < 0 || c.Z < 0 || c.X >= p.Size.X || c.Y >= p.Size.Y || c.Z >= p.Size.Z {
+				t.Fatalf("cell %v lies outside the %v pattern", c, p.Size)
+			}
+		}
+		if p.Rule != "" {
+			if _, err := ParseRule(p.Rule); err != nil {
+				t.Fatalf("pattern read with rule %q: %v", p.Rule, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,430 @@
+package life
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Rule is an outer-totalistic 3D life rule. A dead cell is born when its number of alive
+// neighbors is in the birth set, and an alive cell survives when its count is in the survival set.
+// Neighbors are counted over the rule's neighborhood.
+//
+// Rules of the Generations family have more than two states. An alive cell that doesn't
+// survive starts dying instead of dying at once: it passes through States-2 dying states, one
+// per generation, before it is dead. Dying cells don't count as alive neighbors and can't be
+// born again until they are dead. Brian's Brain is B2/S/C3 in 2D.
+//
+// Rules with more than one species, like Immigration and QuadLife in 2D, count every live cell
+// as a neighbor whatever its species. A newborn cell takes the species most of its live
+// neighbors belong to, with ties settled by the cell's position, and the others keep theirs for
+// life.
+//
+// Stochastic rules only let births and survivals the counts call for happen with a chance, and
+// can bring dead cells to life at random whatever their neighbors. Worlds roll the dice from
+// their seed, so a run is reproducible.
+type Rule struct {
+	// Both sets are indexed by neighbor count, from 0 to the neighborhood size
+	birth   []bool
+	survive []bool
+	// Which cells around a cell count as neighbors
+	Neighborhood Neighborhood
+	// Number of states a cell can be in: dead, alive and the dying states. Plain life rules
+	// have 2.
+	States int
+	// Number of species live cells belong to. Plain life rules have 1.
+	Species int
+	// Chance that a birth and a survival the counts call for happen, and that a dead cell is
+	// born at random each generation. Plain life rules have 1, 1 and 0.
+	BirthChance, SurvivalChance, Noise float64
+}
+
+// Cell states. States from StateDying up to the rule's States-1 are the dying states.
+const (
+	StateDead  = 0
+	StateAlive = 1
+	StateDying = 2
+	maxStates  = 255
+	// species are numbered from 1 and stored in a byte
+	maxSpecies = 255
+)
+
+// DefaultRule is the rule bubblelife has always used: birth on 5-7 neighbors, survival on 4-9.
+var DefaultRule = MustParseRule("B5-7/S4-9")
+
+// ParseRule parses a rule in B/S notation ("B5-7/S4-9", "S4,5/B5") or in Bays' notation
+// ("4555", "4/9/5/7"), which lists the survival range followed by the birth range.
+// B/S rules can pick a neighborhood other than the 26 cell Moore one with a third part,
+// like "B2/S1-3/NV" or "B10-14/S9-18/NM2", give a Generations rule its number of states
+// with a "C" part, like "B4/S/C3" or "B4/S/NV/C5", give the number of species with a
+// "K" part, like "B5-7/S4-9/K4", and make the rule stochastic with "PB", "PS" and "PN" parts
+// for the birth and survival chances and the noise, like "B5-7/S4-9/PB0.9/PN0.0001".
+func ParseRule(s string) (Rule, error) {
+	text := strings.ToUpper(strings.TrimSpace(s))
+	if text == "" {
+		return Rule{}, fmt.Errorf("rule is empty")
+	}
+
+	r := Rule{Neighborhood: MooreNeighborhood, States: 2, Species: 1, BirthChance: 1, SurvivalChance: 1}
+	var err error
+	if strings.ContainsAny(text, "BS") {
+		err = r.parseBS(text)
+	} else {
+		err = r.parseBays(text)
+	}
+	if err != nil {
+		return Rule{}, fmt.Errorf("rule %q: %w", s, err)
+	}
+	return r, nil
+}
+
+// MustParseRule is like ParseRule but panics if the rule can't be parsed. It is meant for
+// rules that are known to be valid at compile time.
+func MustParseRule(s string) Rule {
+	r, err := ParseRule(s)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+// parseBS fills the rule from "B<counts>/S<counts>[/N<neighborhood>][/C<states>][/K<species>]"
+// followed by any of "/PB<chance>", "/PS<chance>" and "/PN<chance>", where counts are comma
+// separated numbers or ranges. Either count part may be empty or come first.
+func (r *Rule) parseBS(text string) error {
+	var parts []string
+	for _, part := range strings.Split(text, "/") {
+		switch {
+		case strings.HasPrefix(part, "P"):
+			if err := r.parseChance(part); err != nil {
+				return err
+			}
+		case strings.HasPrefix(part, "N"):
+			n, err := parseNeighborhood(part)
+			if err != nil {
+				return err
+			}
+			r.Neighborhood = n
+		case strings.HasPrefix(part, "C"):
+			states, err := strconv.Atoi(part[1:])
+			if err != nil || states < 2 || states > maxStates {
+				return fmt.Errorf("number of states %q must be between 2 and %d", part[1:], maxStates)
+			}
+			r.States = states
+		case strings.HasPrefix(part, "K"):
+			species, err := strconv.Atoi(part[1:])
+			if err != nil || species < 1 || species > maxSpecies {
+				return fmt.Errorf("number of species %q must be between 1 and %d", part[1:], maxSpecies)
+			}
+			r.Species = species
+		default:
+			parts = append(parts, part)
+		}
+	}
+	if len(parts) != 2 {
+		return fmt.Errorf("expected birth and survival parts separated by '/', like B5-7/S4-9")
+	}
+
+	size := r.Neighborhood.Size()
+	r.birth = make([]bool, size+1)
+	r.survive = make([]bool, size+1)
+	seen := map[byte]bool{}
+	for _, part := range parts {
+		if part == "" || (part[0] != 'B' && part[0] != 'S') {
+			return fmt.Errorf("part %q must start with B or S", part)
+		}
+		if seen[part[0]] {
+			return fmt.Errorf("%c is given more than once", part[0])
+		}
+		seen[part[0]] = true
+
+		counts := r.birth
+		name := "birth"
+		if part[0] == 'S' {
+			counts = r.survive
+			name = "survival"
+		}
+		if err := parseCounts(part[1:], name, counts); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseChance sets one of the chances of a stochastic rule from "PB0.9", "PS0.95" or "PN0.001".
+func (r *Rule) parseChance(part string) error {
+	if len(part) < 2 {
+		return fmt.Errorf("chance %q must be PB, PS or PN followed by a number from 0 to 1", part)
+	}
+	value, err := strconv.ParseFloat(part[2:], 64)
+	// Written so NaN, which compares false with everything, is turned away too
+	if err != nil || !(value >= 0 && value <= 1) {
+		return fmt.Errorf("chance %q must be a number from 0 to 1", part[2:])
+	}
+	switch part[1] {
+	case 'B':
+		r.BirthChance = value
+	case 'S':
+		r.SurvivalChance = value
+	case 'N':
+		r.Noise = value
+	default:
+		return fmt.Errorf("chance %q must be PB (birth), PS (survival) or PN (noise)", part)
+	}
+	return nil
+}
+
+// parseBays fills the rule from Bays' "ElEuFlFu" notation: a living cell survives with
+// El..Eu neighbors and a dead cell is born with Fl..Fu neighbors. The four numbers are
+// either single digits or separated by slashes.
+func (r *Rule) parseBays(text string) error {
+	fields := strings.Split(text, "/")
+	if len(fields) == 1 {
+		if len(text) != 4 {
+			return fmt.Errorf("expected B/S notation or four digits in Bays' notation, like 4555")
+		}
+		fields = strings.Split(text, "")
+	}
+	if len(fields) != 4 {
+		return fmt.Errorf("expected four numbers in Bays' notation, like 4/5/5/5")
+	}
+
+	size := r.Neighborhood.Size()
+	r.birth = make([]bool, size+1)
+	r.survive = make([]bool, size+1)
+	var values [4]int
+	for i, field := range fields {
+		n, err := parseCount(field, "Bays", size)
+		if err != nil {
+			return err
+		}
+		values[i] = n
+	}
+	if values[0] > values[1] {
+		return fmt.Errorf("survival range %d-%d is backwards", values[0], values[1])
+	}
+	if values[2] > values[3] {
+		return fmt.Errorf("birth range %d-%d is backwards", values[2], values[3])
+	}
+	for n := values[0]; n <= values[1]; n++ {
+		r.survive[n] = true
+	}
+	for n := values[2]; n <= values[3]; n++ {
+		r.birth[n] = true
+	}
+	return nil
+}
+
+// parseCounts marks every count listed in text, e.g. "4,6-8".
+func parseCounts(text, name string, counts []bool) error {
+	if text == "" {
+		return nil
+	}
+	for _, item := range strings.Split(text, ",") {
+		lo, hi, isRange := strings.Cut(item, "-")
+		from, err := parseCount(lo, name, len(counts)-1)
+		if err != nil {
+			return err
+		}
+		to := from
+		if isRange {
+			to, err = parseCount(hi, name, len(counts)-1)
+			if err != nil {
+				return err
+			}
+			if from > to {
+				return fmt.Errorf("%s range %s is backwards", name, item)
+			}
+		}
+		for n := from; n <= to; n++ {
+			counts[n] = true
+		}
+	}
+	return nil
+}
+
+// parseCount parses a single neighbor count and checks it fits a neighborhood of the given size.
+func parseCount(text, name string, size int) (int, error) {
+	n, err := strconv.Atoi(text)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s count %q is not a number", name, text)
+	}
+	if n > size {
+		return 0, fmt.Errorf("%s count %d is more than the %d neighbors a cell has (separate counts with commas, like S4,5)", name, n, size)
+	}
+	return n, nil
+}
+
+// Born reports whether a dead cell with n alive neighbors comes to life.
+func (r Rule) Born(n int) bool {
+	return n >= 0 && n < len(r.birth) && r.birth[n]
+}
+
+// Survives reports whether an alive cell with n alive neighbors stays alive.
+func (r Rule) Survives(n int) bool {
+	return n >= 0 && n < len(r.survive) && r.survive[n]
+}
+
+// Next returns the state a cell in the given state moves to when it has n alive neighbors.
+func (r Rule) Next(state, n int) int {
+	switch {
+	case state == StateDead:
+		if r.Born(n) {
+			return StateAlive
+		}
+		return StateDead
+	case state == StateAlive && r.Survives(n):
+		return StateAlive
+	default:
+		return r.dying(state)
+	}
+}
+
+// dying returns the state an alive or dying cell that doesn't survive moves to.
+func (r Rule) dying(state int) int {
+	if state+1 < r.States {
+		// Start or keep dying
+		return state + 1
+	}
+	return StateDead
+}
+
+// Stochastic reports whether the rule leaves anything to chance.
+func (r Rule) Stochastic() bool {
+	return r.BirthChance < 1 || r.SurvivalChance < 1 || r.Noise > 0
+}
+
+// nextRandom returns the state a cell in the given state moves to when it has n alive
+// neighbors, like Next, with the rule's chances decided by rolls of d.
+func (r Rule) nextRandom(state, n int, d *dice) int {
+	switch {
+	case state == StateDead:
+		if r.rollBirth(r.Born(n), d) {
+			return StateAlive
+		}
+		return StateDead
+	case state == StateAlive && r.Survives(n) && r.rollSurvival(d):
+		return StateAlive
+	default:
+		return r.dying(state)
+	}
+}
+
+// rollBirth decides whether a dead cell comes to life, given whether its counts call for a birth.
+func (r Rule) rollBirth(born bool, d *dice) bool {
+	return (born && d.chance(r.BirthChance)) || d.chance(r.Noise)
+}
+
+// rollSurvival decides whether an alive cell whose counts call for survival survives.
+func (r Rule) rollSurvival(d *dice) bool {
+	return d.chance(r.SurvivalChance)
+}
+
+// WithNeighborhood returns the rule counted over another neighborhood. Counts that are
+// larger than the new neighborhood are dropped.
+func (r Rule) WithNeighborhood(n Neighborhood) Rule {
+	size := n.Size()
+	moved := Rule{
+		birth:          make([]bool, size+1),
+		survive:        make([]bool, size+1),
+		Neighborhood:   n,
+		States:         r.States,
+		Species:        r.Species,
+		BirthChance:    r.BirthChance,
+		SurvivalChance: r.SurvivalChance,
+		Noise:          r.Noise,
+	}
+	copy(moved.birth, r.birth)
+	copy(moved.survive, r.survive)
+	return moved
+}
+
+// Equal reports whether both rules give the same results.
+func (r Rule) Equal(other Rule) bool {
+	return r.String() == other.String()
+}
+
+// String returns the rule in B/S notation with consecutive counts collapsed into ranges.
+// The neighborhood is only written when it isn't the default Moore neighborhood, the number
+// of states only for Generations rules, the number of species only when there are several, and
+// the chances only for stochastic rules.
+func (r Rule) String() string {
+	s := "B" + formatCounts(r.birth) + "/S" + formatCounts(r.survive)
+	if r.Neighborhood != MooreNeighborhood {
+		s += "/" + r.Neighborhood.String()
+	}
+	if r.States > 2 {
+		s += fmt.Sprintf("/C%d", r.States)
+	}
+	if r.Species > 1 {
+		s += fmt.Sprintf("/K%d", r.Species)
+	}
+	if r.BirthChance < 1 {
+		s += fmt.Sprintf("/PB%g", r.BirthChance)
+	}
+	if r.SurvivalChance < 1 {
+		s += fmt.Sprintf("/PS%g", r.SurvivalChance)
+	}
+	if r.Noise > 0 {
+		s += fmt.Sprintf("/PN%g", r.Noise)
+	}
+	return s
+}
+
+// Bays returns the rule in Bays' four digit notation, if it can be written that way.
+// Bays' notation always counts over the Moore neighborhood and has two states and one species,
+// and leaves nothing to chance.
+func (r Rule) Bays() (string, bool) {
+	if r.Neighborhood != MooreNeighborhood || r.States > 2 || r.Species > 1 || r.Stochastic() {
+		return "", false
+	}
+	sLo, sHi, ok := singleRange(r.survive)
+	if !ok {
+		return "", false
+	}
+	bLo, bHi, ok := singleRange(r.birth)
+	if !ok {
+		return "", false
+	}
+	if sHi > 9 || bHi > 9 {
+		return fmt.Sprintf("%d/%d/%d/%d", sLo, sHi, bLo, bHi), true
+	}
+	return fmt.Sprintf("%d%d%d%d", sLo, sHi, bLo, bHi), true
+}
+
+// formatCounts writes the marked counts as a comma separated list of numbers and ranges.
+func formatCounts(counts []bool) string {
+	var items []string
+	for n := 0; n < len(counts); n++ {
+		if !counts[n] {
+			continue
+		}
+		start := n
+		for n+1 < len(counts) && counts[n+1] {
+			n++
+		}
+		if start == n {
+			items = append(items, strconv.Itoa(n))
+		} else {
+			items = append(items, fmt.Sprintf("%d-%d", start, n))
+		}
+	}
+	return strings.Join(items, ",")
+}
+
+// singleRange returns the bounds of the marked counts if they form one unbroken range.
+func singleRange(counts []bool) (lo, hi int, ok bool) {
+	lo = -1
+	for n := 0; n < len(counts); n++ {
+		if !counts[n] {
+			continue
+		}
+		if lo == -1 {
+			lo = n
+		} else if hi != n-1 {
+			return 0, 0, false
+		}
+		hi = n
+	}
+	return lo, hi, lo != -1
+}
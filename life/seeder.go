@@ -0,0 +1,356 @@
+package life
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+)
+
+// SeederKind is the kind of starting pattern a Seeder fills a box with.
+type SeederKind int
+
+const (
+	// RandomSeeder makes every cell alive with the same chance
+	RandomSeeder SeederKind = iota
+	// SphereSeeder and CubeSeeder fill a ball or a cube centered in the box at random
+	SphereSeeder
+	CubeSeeder
+	// NoiseSeeder makes cells alive where smooth Perlin noise is high, giving blobs and tunnels
+	NoiseSeeder
+	// ClusterSeeder scatters clumps of cells that thin out from their centers like a Gaussian
+	ClusterSeeder
+	// MirrorSeeder fills the box at random, mirrored across its middle along some axes
+	MirrorSeeder
+	// EmptySeeder leaves every cell dead, for patterns placed by hand
+	EmptySeeder
+)
+
+// SeederKinds are all the kinds of seeder, in the order menus cycle through them.
+var SeederKinds = []SeederKind{RandomSeeder, SphereSeeder, CubeSeeder, NoiseSeeder, ClusterSeeder, MirrorSeeder, EmptySeeder}
+
+var seederNames = map[SeederKind]string{
+	RandomSeeder:  "random",
+	SphereSeeder:  "sphere",
+	CubeSeeder:    "cube",
+	NoiseSeeder:   "noise",
+	ClusterSeeder: "clusters",
+	MirrorSeeder:  "mirror",
+	EmptySeeder:   "empty",
+}
+
+// seederSettings are the settings each kind of seeder uses, in the order they are written.
+var seederSettings = map[SeederKind][]string{
+	RandomSeeder:  {"density"},
+	SphereSeeder:  {"radius", "density"},
+	CubeSeeder:    {"radius", "density"},
+	NoiseSeeder:   {"scale", "threshold", "density"},
+	ClusterSeeder: {"count", "spread", "density"},
+	MirrorSeeder:  {"axes", "density"},
+}
+
+// String returns the kind's name.
+func (k SeederKind) String() string {
+	return seederNames[k]
+}
+
+// Seeder fills a box of cells with a starting pattern. Each kind only uses some of the
+// settings, see Settings.
+type Seeder struct {
+	Kind SeederKind
+	// Chance that a cell the pattern covers is alive
+	Density float64
+	// Distance from the center of a sphere or cube to its surface, as a share of half the
+	// shortest side of the box
+	Radius float64
+	// Size of the features of noise in cells, and the level of noise from 0 to 1 above which
+	// cells are alive
+	Scale, Threshold float64
+	// Number of clusters, and how far they spread in cells
+	Count  int
+	Spread float64
+	// Axes the box is mirrored along, like "x" or "xz"
+	Axes string
+}
+
+// MaxSeederCount is the most clusters a seeder scatters. Every cell is weighed against every
+// cluster, so many more would take too long to fill a pillar.
+const MaxSeederCount = 1000
+
+// DefaultSeeder is the soup bubblelife has always started from: 40% of the cells alive.
+var DefaultSeeder = NewSeeder(RandomSeeder)
+
+// NewSeeder returns a seeder of a kind with the settings that suit it.
+func NewSeeder(kind SeederKind) Seeder {
+	s := Seeder{Kind: kind, Density: 0.4, Radius: 0.6, Scale: 4, Threshold: 0.6, Count: 5, Spread: 2, Axes: "x"}
+	switch kind {
+	case SphereSeeder, CubeSeeder:
+		s.Density = 0.6
+	case NoiseSeeder:
+		s.Density = 1
+	case ClusterSeeder:
+		s.Density = 0.9
+	}
+	return s
+}
+
+// ParseSeeder parses a seeder like "random", "sphere:radius=0.5,density=0.8" or "mirror:axes=xz".
+// Settings that aren't given keep the kind's defaults.
+func ParseSeeder(s string) (Seeder, error) {
+	text := strings.ToLower(strings.TrimSpace(s))
+	name, settings, _ := strings.Cut(text, ":")
+	seeder := DefaultSeeder
+	found := name == ""
+	for kind, kindName := range seederNames {
+		if name == kindName {
+			seeder, found = NewSeeder(kind), true
+		}
+	}
+	if !found {
+		return seeder, fmt.Errorf("unknown seeder %q, use random, sphere, cube, noise, clusters, mirror or empty", name)
+	}
+	if strings.TrimSpace(settings) == "" {
+		return seeder, seeder.Check()
+	}
+
+	for _, item := range strings.Split(settings, ",") {
+		setting, value, ok := strings.Cut(item, "=")
+		setting, value = strings.TrimSpace(setting), strings.TrimSpace(value)
+		if !ok {
+			return seeder, fmt.Errorf("seeder setting %q must look like name=value", item)
+		}
+		known := false
+		for _, s := range seeder.Settings() {
+			known = known || s == setting
+		}
+		if !known {
+			return seeder, fmt.Errorf("%s seeder has no setting %q, use %s", seeder.Kind, setting, strings.Join(seeder.Settings(), ", "))
+		}
+		var err error
+		switch setting {
+		case "density":
+			seeder.Density, err = strconv.ParseFloat(value, 64)
+		case "radius":
+			seeder.Radius, err = strconv.ParseFloat(value, 64)
+		case "scale":
+			seeder.Scale, err = strconv.ParseFloat(value, 64)
+		case "threshold":
+			seeder.Threshold, err = strconv.ParseFloat(value, 64)
+		case "count":
+			seeder.Count, err = strconv.Atoi(value)
+		case "spread":
+			seeder.Spread, err = strconv.ParseFloat(value, 64)
+		case "axes":
+			seeder.Axes = value
+		}
+		if err != nil {
+			return seeder, fmt.Errorf("seeder setting %s: %q is not a number", setting, value)
+		}
+	}
+	return seeder, seeder.Check()
+}
+
+// Settings returns the names of the settings the seeder's kind uses.
+func (s Seeder) Settings() []string {
+	return seederSettings[s.Kind]
+}
+
+// Check reports settings that can't seed anything sensible.
+func (s Seeder) Check() error {
+	// Written so NaN, which compares false with everything, is turned away too
+	switch {
+	case !(s.Density >= 0 && s.Density <= 1):
+		return fmt.Errorf("seeder density must be from 0 to 1, got %g", s.Density)
+	case !(s.Radius > 0):
+		return fmt.Errorf("seeder radius must be positive, got %g", s.Radius)
+	case !(s.Scale > 0):
+		return fmt.Errorf("seeder scale must be positive, got %g", s.Scale)
+	case !(s.Threshold >= 0 && s.Threshold <= 1):
+		return fmt.Errorf("seeder threshold must be from 0 to 1, got %g", s.Threshold)
+	case s.Count < 1 || s.Count > MaxSeederCount:
+		return fmt.Errorf("seeder count must be from 1 to %d, got %d", MaxSeederCount, s.Count)
+	case !(s.Spread > 0):
+		return fmt.Errorf("seeder spread must be positive, got %g", s.Spread)
+	}
+	if s.Axes == "" || strings.Trim(s.Axes, "xyz") != "" {
+		return fmt.Errorf("seeder axes must be some of x, y and z, got %q", s.Axes)
+	}
+	return nil
+}
+
+// String returns the seeder in the form ParseSeeder reads, with the settings its kind uses.
+func (s Seeder) String() string {
+	settings := make([]string, len(s.Settings()))
+	for i, name := range s.Settings() {
+		settings[i] = name + "=" + s.Setting(name)
+	}
+	if len(settings) == 0 {
+		return s.Kind.String()
+	}
+	return s.Kind.String() + ":" + strings.Join(settings, ",")
+}
+
+// Setting returns the value of a setting as ParseSeeder reads it.
+func (s Seeder) Setting(name string) string {
+	switch name {
+	case "density":
+		return strconv.FormatFloat(s.Density, 'g', -1, 64)
+	case "radius":
+		return strconv.FormatFloat(s.Radius, 'g', -1, 64)
+	case "scale":
+		return strconv.FormatFloat(s.Scale, 'g', -1, 64)
+	case "threshold":
+		return strconv.FormatFloat(s.Threshold, 'g', -1, 64)
+	case "count":
+		return strconv.Itoa(s.Count)
+	case "spread":
+		return strconv.FormatFloat(s.Spread, 'g', -1, 64)
+	case "axes":
+		return s.Axes
+	}
+	return ""
+}
+
+// Fill sets every cell in the box from the origin to size alive or dead. The same seed always
+// gives the same cells, and the random seeder gives the same cells as FillRandom.
+func (s Seeder) Fill(w World, size Size, seed int64) {
+	if s.Kind == RandomSeeder {
+		FillRandom(w, size, float32(s.Density), seed)
+		return
+	}
+
+	rnd := rand.New(rand.NewSource(seed))
+	center := [3]float64{float64(size.X-1) / 2, float64(size.Y-1) / 2, float64(size.Z-1) / 2}
+	radius := s.Radius * float64(min(size.X, size.Y, size.Z)) / 2
+	var noise *perlin
+	if s.Kind == NoiseSeeder {
+		noise = newPerlin(rnd)
+	}
+	var clusters [][3]float64
+	if s.Kind == ClusterSeeder {
+		// More clusters than cells can't make a difference
+		clusters = make([][3]float64, min(s.Count, MaxSeederCount, size.Cells()))
+		for i := range clusters {
+			clusters[i] = [3]float64{rnd.Float64() * float64(size.X), rnd.Float64() * float64(size.Y), rnd.Float64() * float64(size.Z)}
+		}
+	}
+
+	for x := 0; x < size.X; x++ {
+		for y := 0; y < size.Y; y++ {
+			for z := 0; z < size.Z; z++ {
+				p := Point{x, y, z}
+				d := [3]float64{float64(x) - center[0], float64(y) - center[1], float64(z) - center[2]}
+				// chance the cell is alive
+				chance := 0.0
+				switch s.Kind {
+				case SphereSeeder:
+					if math.Sqrt(d[0]*d[0]+d[1]*d[1]+d[2]*d[2]) <= radius {
+						chance = s.Density
+					}
+				case CubeSeeder:
+					if max(math.Abs(d[0]), math.Abs(d[1]), math.Abs(d[2])) <= radius {
+						chance = s.Density
+					}
+				case NoiseSeeder:
+					if noise.at(float64(x)/s.Scale, float64(y)/s.Scale, float64(z)/s.Scale) > s.Threshold {
+						chance = s.Density
+					}
+				case ClusterSeeder:
+					for _, c := range clusters {
+						dx, dy, dz := float64(x)-c[0], float64(y)-c[1], float64(z)-c[2]
+						chance = max(chance, s.Density*math.Exp(-(dx*dx+dy*dy+dz*dz)/(2*s.Spread*s.Spread)))
+					}
+				case MirrorSeeder:
+					// Cells past the middle copy their mirror image, which comes first in this order
+					if mirror := s.mirror(p, size); mirror != p {
+						w.Set(p, w.Alive(mirror))
+						continue
+					}
+					chance = s.Density
+				}
+				w.Set(p, rnd.Float64() < chance)
+			}
+		}
+	}
+}
+
+// mirror returns the cell p is a copy of in a mirrored box: its image across the middle of each
+// mirrored axis it is past.
+func (s Seeder) mirror(p Point, size Size) Point {
+	if strings.Contains(s.Axes, "x") && p.X > size.X-1-p.X {
+		p.X = size.X - 1 - p.X
+	}
+	if strings.Contains(s.Axes, "y") && p.Y > size.Y-1-p.Y {
+		p.Y = size.Y - 1 - p.Y
+	}
+	if strings.Contains(s.Axes, "z") && p.Z > size.Z-1-p.Z {
+		p.Z = size.Z - 1 - p.Z
+	}
+	return p
+}
+
+// perlin is Ken Perlin's improved gradient noise, with the permutation shuffled from a seed.
+type perlin struct {
+	permutation [512]int
+}
+
+func newPerlin(rnd *rand.Rand) *perlin {
+	n := &perlin{}
+	for i, v := range rnd.Perm(256) {
+		n.permutation[i], n.permutation[i+256] = v, v
+	}
+	return n
+}
+
+// at returns the noise at a point, from about 0 to 1 and changing smoothly over about a unit.
+func (n *perlin) at(x, y, z float64) float64 {
+	xi, yi, zi := int(math.Floor(x))&255, int(math.Floor(y))&255, int(math.Floor(z))&255
+	x, y, z = x-math.Floor(x), y-math.Floor(y), z-math.Floor(z)
+	u, v, w := fade(x), fade(y), fade(z)
+
+	p := &n.permutation
+	a := p[xi] + yi
+	aa, ab := p[a]+zi, p[a+1]+zi
+	b := p[xi+1] + yi
+	ba, bb := p[b]+zi, p[b+1]+zi
+
+	value := lerp(w,
+		lerp(v,
+			lerp(u, grad(p[aa], x, y, z), grad(p[ba], x-1, y, z)),
+			lerp(u, grad(p[ab], x, y-1, z), grad(p[bb], x-1, y-1, z))),
+		lerp(v,
+			lerp(u, grad(p[aa+1], x, y, z-1), grad(p[ba+1], x-1, y, z-1)),
+			lerp(u, grad(p[ab+1], x, y-1, z-1), grad(p[bb+1], x-1, y-1, z-1))))
+	return (value + 1) / 2
+}
+
+func fade(t float64) float64 {
+	return t * t * t * (t*(t*6-15) + 10)
+}
+
+func lerp(t, a, b float64) float64 {
+	return a + t*(b-a)
+}
+
+// grad returns the dot product of a corner's gradient, picked by its hash, with the distance
+// from the corner.
+func grad(hash int, x, y, z float64) float64 {
+	h := hash & 15
+	u, v := y, z
+	if h < 8 {
+		u = x
+	}
+	if h < 4 {
+		v = y
+	} else if h == 12 || h == 14 {
+		v = x
+	}
+	if h&1 != 0 {
+		u = -u
+	}
+	if h&2 != 0 {
+		v = -v
+	}
+	return u + v
+}
@@ -0,0 +1,78 @@
+package life
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestParseSeeder(t *testing.T) {
+	tests := []struct {
+		text string
+		// the seeder written back by String, or the error
+		want, err string
+	}{
+		{"", "random:density=0.4", ""},
+		{"random", "random:density=0.4", ""},
+		{" Sphere:Radius=0.5, density=0.8 ", "sphere:radius=0.5,density=0.8", ""},
+		{"cube:radius=2", "cube:radius=2,density=0.6", ""},
+		{"noise:scale=6,threshold=0", "noise:scale=6,threshold=0,density=1", ""},
+		{"clusters:count=1000,spread=0.5", "clusters:count=1000,spread=0.5,density=0.9", ""},
+		{"mirror:axes=xz", "mirror:axes=xz,density=0.4", ""},
+		{"empty", "empty", ""},
+		{"blob", "", `unknown seeder "blob", use random, sphere, cube, noise, clusters, mirror or empty`},
+		{"sphere:radius", "", `seeder setting "radius" must look like name=value`},
+		{"sphere:scale=2", "", `sphere seeder has no setting "scale", use radius, density`},
+		{"sphere:radius=big", "", `seeder setting radius: "big" is not a number`},
+		{"random:density=1.5", "", "seeder density must be from 0 to 1, got 1.5"},
+		{"sphere:density=NaN", "", "seeder density must be from 0 to 1, got NaN"},
+		{"sphere:radius=0", "", "seeder radius must be positive, got 0"},
+		{"sphere:radius=NaN", "", "seeder radius must be positive, got NaN"},
+		{"noise:scale=-1", "", "seeder scale must be positive, got -1"},
+		{"noise:scale=NaN", "", "seeder scale must be positive, got NaN"},
+		{"noise:threshold=NaN", "", "seeder threshold must be from 0 to 1, got NaN"},
+		{"clusters:count=0", "", "seeder count must be from 1 to 1000, got 0"},
+		{"clusters:count=1000000000", "", "seeder count must be from 1 to 1000, got 1000000000"},
+		{"clusters:spread=NaN", "", "seeder spread must be positive, got NaN"},
+		{"mirror:axes=xw", "", `seeder axes must be some of x, y and z, got "xw"`},
+	}
+	for _, test := range tests {
+		s, err := ParseSeeder(test.text)
+		switch {
+		case test.err != "":
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%q: got error %v, want %q", test.text, err, test.err)
+			}
+		case err != nil:
+			t.Errorf("%q: %v", test.text, err)
+		case s.String() != test.want:
+			t.Errorf("%q: read as %s, want %s", test.text, s, test.want)
+		}
+	}
+
+	// Every kind's defaults can seed, and read back as the same seeder
+	for _, kind := range SeederKinds {
+		s := NewSeeder(kind)
+		if err := s.Check(); err != nil {
+			t.Errorf("%s seeder: %v", kind, err)
+		}
+		if parsed, err := ParseSeeder(s.String()); err != nil || parsed != s {
+			t.Errorf("%s seeder read back as %+v, %v", kind, parsed, err)
+		}
+	}
+}
+
+func TestSeederFill(t *testing.T) {
+	size := Size{X: 9, Y: 8, Z: 7}
+	for _, kind := range SeederKinds {
+		s := NewSeeder(kind)
+		a, b := NewGrid(size, DefaultRule, Torus), NewGrid(size, DefaultRule, Torus)
+		s.Fill(a, size, 4)
+		s.Fill(b, size, 4)
+		if !slices.Equal(a.LiveCells(), b.LiveCells()) {
+			t.Errorf("%s seeder filled different cells from the same seed", kind)
+		}
+		if empty := a.Population() == 0; empty != (kind == EmptySeeder) {
+			t.Errorf("%s seeder made %d cells alive", kind, a.Population())
+		}
+	}
+}
@@ -0,0 +1,371 @@
+package life
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// Snapshot is a compressed copy of the cells of a world at one generation, which the world can be
+// set back to later. The rule, boundary and other settings aren't part of it.
+type Snapshot struct {
+	// Generation the snapshot was taken at
+	Generation int
+	// Cells holds the cells, deflated
+	Cells []byte
+}
+
+// Rewinder is a world that can take snapshots of itself and go back to them. Snapshots of a Grid
+// and a BitGrid of the same size fit each other, and so do those of Sparse and HashLife worlds.
+type Rewinder interface {
+	World
+	// Snapshot returns a copy of the current generation.
+	Snapshot() Snapshot
+	// Restore sets the cells and the generation back to a snapshot.
+	Restore(s Snapshot) error
+}
+
+// Kinds of snapshot, written as the first byte of the cells
+const (
+	// the state of every cell of a box, then their species for rules with several
+	snapshotBox byte = iota + 1
+	// the packed key, state and species of every cell that isn't dead
+	snapshotCells
+	// the value of every cell of a continuous box
+	snapshotValues
+)
+
+// compress deflates cells. Snapshots are taken every generation, so speed matters more than
+// size.
+func compress(cells []byte) []byte {
+	var buf bytes.Buffer
+	w, _ := flate.NewWriter(&buf, flate.BestSpeed)
+	w.Write(cells)
+	w.Close()
+	return buf.Bytes()
+}
+
+// decompress inflates the cells of a snapshot and checks they are of the given kind.
+func decompress(s Snapshot, kind byte) ([]byte, error) {
+	cells, err := io.ReadAll(flate.NewReader(bytes.NewReader(s.Cells)))
+	if err != nil {
+		return nil, fmt.Errorf("snapshot of generation %d is damaged: %w", s.Generation, err)
+	}
+	if len(cells) == 0 || cells[0] != kind {
+		return nil, fmt.Errorf("snapshot of generation %d was taken of another kind of world", s.Generation)
+	}
+	return cells[1:], nil
+}
+
+// appendSize writes the size of a box.
+func appendSize(cells []byte, size Size) []byte {
+	cells = binary.AppendUvarint(cells, uint64(size.X))
+	cells = binary.AppendUvarint(cells, uint64(size.Y))
+	return binary.AppendUvarint(cells, uint64(size.Z))
+}
+
+// readSize reads the size of a box and checks it is the size of the world.
+func readSize(cells []byte, size Size) ([]byte, error) {
+	var sides [3]uint64
+	for i := range sides {
+		side, n := binary.Uvarint(cells)
+		if n <= 0 {
+			return nil, fmt.Errorf("snapshot is cut short")
+		}
+		sides[i], cells = side, cells[n:]
+	}
+	if sides != [3]uint64{uint64(size.X), uint64(size.Y), uint64(size.Z)} {
+		return nil, fmt.Errorf("snapshot of a %dx%dx%d box doesn't fit a %dx%dx%d world",
+			sides[0], sides[1], sides[2], size.X, size.Y, size.Z)
+	}
+	return cells, nil
+}
+
+// boxSnapshot takes a snapshot from the states of every cell of a box and, for rules with
+// several species, their species, both in the order given by Grid.Index.
+func boxSnapshot(generation int, size Size, states, species []uint8) Snapshot {
+	cells := appendSize([]byte{snapshotBox}, size)
+	cells = append(cells, states...)
+	cells = append(cells, species...)
+	return Snapshot{Generation: generation, Cells: compress(cells)}
+}
+
+// readBoxSnapshot returns the states and species of every cell of a box snapshot, checking
+// they fit the world's size and rule. Species are nil if the snapshot has none.
+func readBoxSnapshot(s Snapshot, size Size, rule Rule) (states, species []uint8, err error) {
+	cells, err := decompress(s, snapshotBox)
+	if err == nil {
+		cells, err = readSize(cells, size)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	states = cells[:min(len(cells), size.Cells())]
+	switch len(cells) {
+	case size.Cells():
+	case 2 * size.Cells():
+		species = cells[size.Cells():]
+	default:
+		return nil, nil, fmt.Errorf("snapshot is cut short")
+	}
+	for i, state := range states {
+		if err := checkCell(rule, int(state), species, i); err != nil {
+			return nil, nil, err
+		}
+	}
+	return states, species, nil
+}
+
+// checkCell reports a cell of a snapshot that the rule can't have. Species are only checked
+// if the snapshot has them.
+func checkCell(rule Rule, state int, species []uint8, i int) error {
+	if state >= max(rule.States, 2) {
+		return fmt.Errorf("snapshot has cells in state %d, which rule %s doesn't have", state, rule)
+	}
+	if species != nil && state != StateDead && int(species[i]) > max(rule.Species, 1) {
+		return fmt.Errorf("snapshot has cells of species %d, which rule %s doesn't have", species[i], rule)
+	}
+	return nil
+}
+
+// Snapshot returns a copy of the current generation.
+func (g *Grid) Snapshot() Snapshot {
+	var species []uint8
+	if g.rule.Species > 1 {
+		species = g.species
+	}
+	return boxSnapshot(g.generation, g.size, g.cells, species)
+}
+
+// Restore sets the cells and the generation back to a snapshot of a box of the same size.
+func (g *Grid) Restore(s Snapshot) error {
+	states, species, err := readBoxSnapshot(s, g.size, g.rule)
+	if err != nil {
+		return err
+	}
+	copy(g.cells, states)
+	if g.species != nil {
+		if species != nil {
+			copy(g.species, species)
+		} else {
+			for i := range g.species {
+				g.species[i] = 1
+			}
+		}
+	}
+	g.generation = s.Generation
+	return nil
+}
+
+// Snapshot returns a copy of the current generation.
+func (g *BitGrid) Snapshot() Snapshot {
+	states := make([]uint8, g.size.Cells())
+	for x := 0; x < g.size.X; x++ {
+		for y := 0; y < g.size.Y; y++ {
+			for z := 0; z < g.size.Z; z++ {
+				p := Point{x, y, z}
+				states[g.index(p)] = uint8(g.State(p))
+			}
+		}
+	}
+	var species []uint8
+	if g.rule.Species > 1 {
+		species = g.species
+	}
+	return boxSnapshot(g.generation, g.size, states, species)
+}
+
+// Restore sets the cells and the generation back to a snapshot of a box of the same size.
+func (g *BitGrid) Restore(s Snapshot) error {
+	states, species, err := readBoxSnapshot(s, g.size, g.rule)
+	if err != nil {
+		return err
+	}
+	clear(g.cells)
+	clear(g.dying)
+	for x := 0; x < g.size.X; x++ {
+		for y := 0; y < g.size.Y; y++ {
+			cells, dying := g.row(g.cells, x, y), g.row(g.dying, x, y)
+			for z := 0; z < g.size.Z; z++ {
+				i := g.index(Point{x, y, z})
+				switch states[i] {
+				case StateDead:
+				case StateAlive:
+					cells[z/64] |= 1 << (z % 64)
+				default:
+					dying[z/64] |= 1 << (z % 64)
+					g.ages[i] = states[i]
+				}
+			}
+		}
+	}
+	if g.species != nil {
+		if species != nil {
+			copy(g.species, species)
+		} else {
+			for i := range g.species {
+				g.species[i] = 1
+			}
+		}
+	}
+	g.generation = s.Generation
+	return nil
+}
+
+// cellsSnapshot takes a snapshot from the cells of an unbounded world, which must be sorted
+// by key. Keys are written as the difference to the one before, so nearby cells take a byte
+// or two.
+func cellsSnapshot(generation int, keys []cellKey, states, species func(cellKey) uint8) Snapshot {
+	cells := binary.AppendUvarint([]byte{snapshotCells}, uint64(len(keys)))
+	var last cellKey
+	for _, key := range keys {
+		cells = binary.AppendUvarint(cells, uint64(key-last))
+		cells = append(cells, states(key), species(key))
+		last = key
+	}
+	return Snapshot{Generation: generation, Cells: compress(cells)}
+}
+
+// readCellsSnapshot calls cell for every cell of a snapshot of an unbounded world, after
+// checking they all fit the rule. Species are 0 if the snapshot has none.
+func readCellsSnapshot(s Snapshot, rule Rule, cell func(key cellKey, state, species uint8)) error {
+	cells, err := decompress(s, snapshotCells)
+	if err != nil {
+		return err
+	}
+	count, n := binary.Uvarint(cells)
+	if n <= 0 {
+		return fmt.Errorf("snapshot is cut short")
+	}
+	cells = cells[n:]
+
+	type entry struct {
+		key            cellKey
+		state, species uint8
+	}
+	entries := make([]entry, 0, min(count, uint64(len(cells))))
+	var key cellKey
+	for i := uint64(0); i < count; i++ {
+		delta, n := binary.Uvarint(cells)
+		if n <= 0 || len(cells) < n+2 {
+			return fmt.Errorf("snapshot is cut short")
+		}
+		key += cellKey(delta)
+		e := entry{key: key, state: cells[n], species: cells[n+1]}
+		cells = cells[n+2:]
+		if e.state == StateDead {
+			return fmt.Errorf("snapshot has a dead cell stored")
+		}
+		species := []uint8{e.species}
+		if e.species == 0 {
+			species = nil
+		}
+		if err := checkCell(rule, int(e.state), species, 0); err != nil {
+			return err
+		}
+		entries = append(entries, e)
+	}
+	for _, e := range entries {
+		cell(e.key, e.state, e.species)
+	}
+	return nil
+}
+
+// Snapshot returns a copy of the current generation.
+func (s *Sparse) Snapshot() Snapshot {
+	keys := make([]cellKey, 0, len(s.cells))
+	for key := range s.cells {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return cellsSnapshot(s.generation, keys,
+		func(key cellKey) uint8 { return s.cells[key] },
+		func(key cellKey) uint8 { return s.species[key] })
+}
+
+// Restore sets the cells and the generation back to a snapshot of an unbounded world.
+func (s *Sparse) Restore(snapshot Snapshot) error {
+	cells := make(map[cellKey]uint8)
+	var species map[cellKey]uint8
+	if s.species != nil {
+		species = make(map[cellKey]uint8)
+	}
+	err := readCellsSnapshot(snapshot, s.rule, func(key cellKey, state, cellSpecies uint8) {
+		cells[key] = state
+		if species != nil {
+			species[key] = max(cellSpecies, 1)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	s.cells, s.species = cells, species
+	s.generation = snapshot.Generation
+	return nil
+}
+
+// Snapshot returns a copy of the current generation.
+func (h *HashLife) Snapshot() Snapshot {
+	points := h.LiveCells()
+	keys := make([]cellKey, len(points))
+	for i, p := range points {
+		keys[i] = packCell(p.X, p.Y, p.Z)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return cellsSnapshot(h.generation, keys,
+		func(cellKey) uint8 { return StateAlive },
+		func(cellKey) uint8 { return 0 })
+}
+
+// Restore sets the cells and the generation back to a snapshot of an unbounded world. The
+// cubes and results worked out so far are kept, since they don't depend on the cells.
+func (h *HashLife) Restore(s Snapshot) error {
+	var points []Point
+	err := readCellsSnapshot(s, h.rule, func(key cellKey, _, _ uint8) {
+		x, y, z := key.unpack()
+		points = append(points, Point{x, y, z})
+	})
+	if err != nil {
+		return err
+	}
+	h.root = h.emptyNode(baseLevel)
+	for _, p := range points {
+		h.Set(p, true)
+	}
+	h.generation = s.Generation
+	return nil
+}
+
+// Snapshot returns a copy of the current generation.
+func (l *Lenia) Snapshot() Snapshot {
+	cells := appendSize([]byte{snapshotValues}, l.size)
+	for _, v := range l.values {
+		cells = binary.LittleEndian.AppendUint64(cells, math.Float64bits(v))
+	}
+	return Snapshot{Generation: l.generation, Cells: compress(cells)}
+}
+
+// Restore sets the values and the generation back to a snapshot of a box of the same size.
+func (l *Lenia) Restore(s Snapshot) error {
+	cells, err := decompress(s, snapshotValues)
+	if err == nil {
+		cells, err = readSize(cells, l.size)
+	}
+	if err != nil {
+		return err
+	}
+	if len(cells) != 8*len(l.values) {
+		return fmt.Errorf("snapshot is cut short")
+	}
+	for i := range l.values {
+		v := math.Float64frombits(binary.LittleEndian.Uint64(cells[8*i:]))
+		l.values[i] = min(max(v, 0), 1)
+	}
+	l.generation = s.Generation
+	return nil
+}
@@ -0,0 +1,273 @@
+package life
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	// bits used for each axis of a packed cell key
+	cellKeyBits = 21
+	// added to coordinates so negative ones pack into unsigned bits
+	cellKeyBias = 1 << (cellKeyBits - 1)
+	cellKeyMask = 1<<cellKeyBits - 1
+)
+
+// cellKey packs the coordinates of a cell into a single map key. Each axis gets 21 bits, so
+// coordinates range over about a million cells either side of the origin before wrapping.
+type cellKey uint64
+
+func packCell(x, y, z int) cellKey {
+	return cellKey(uint64((x+cellKeyBias)&cellKeyMask)<<(2*cellKeyBits) |
+		uint64((y+cellKeyBias)&cellKeyMask)<<cellKeyBits |
+		uint64((z+cellKeyBias)&cellKeyMask))
+}
+
+func (k cellKey) unpack() (x, y, z int) {
+	x = int(uint64(k)>>(2*cellKeyBits)&cellKeyMask) - cellKeyBias
+	y = int(uint64(k)>>cellKeyBits&cellKeyMask) - cellKeyBias
+	z = int(uint64(k)&cellKeyMask) - cellKeyBias
+	return x, y, z
+}
+
+// Sparse is an unbounded world that only stores its live and dying cells, so patterns can
+// travel as far as they like and empty space costs nothing.
+type Sparse struct {
+	rule    Rule
+	lattice Lattice
+	// neighbor offsets of each class of row of the lattice
+	offsets [][][3]int
+	// state of every cell that isn't dead
+	cells map[cellKey]uint8
+	// For rules with several species, the species of every cell that isn't dead
+	species map[cellKey]uint8
+	// seed of the dice of stochastic rules
+	seed       int64
+	generation int
+}
+
+// NewSparse creates an empty sparse world. It fails for rules that can't run unbounded,
+// see CheckUnboundedRule.
+func NewSparse(rule Rule) (*Sparse, error) {
+	s := &Sparse{cells: make(map[cellKey]uint8)}
+	if err := s.SetRule(rule); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// CheckUnboundedRule reports rules that can't run in an unbounded world. A rule that gives
+// birth with no neighbors or at random would fill all of space in one generation.
+func CheckUnboundedRule(rule Rule) error {
+	if rule.Born(0) {
+		return fmt.Errorf("rule %s gives birth with 0 neighbors, which would fill an infinite universe", rule)
+	}
+	if rule.Noise > 0 {
+		return fmt.Errorf("rule %s gives birth at random, which would fill an infinite universe", rule)
+	}
+	return nil
+}
+
+// Generation returns how many generations the world has advanced.
+func (s *Sparse) Generation() int {
+	return s.generation
+}
+
+// Alive reports whether the cell at p is alive.
+func (s *Sparse) Alive(p Point) bool {
+	return s.cells[packCell(p.X, p.Y, p.Z)] == StateAlive
+}
+
+// State returns the state of the cell at p.
+func (s *Sparse) State(p Point) int {
+	return int(s.cells[packCell(p.X, p.Y, p.Z)])
+}
+
+// Set makes the cell at p alive or dead.
+func (s *Sparse) Set(p Point, alive bool) {
+	key := packCell(p.X, p.Y, p.Z)
+	if alive {
+		s.cells[key] = StateAlive
+		if s.species != nil {
+			s.species[key] = 1
+		}
+	} else {
+		delete(s.cells, key)
+		delete(s.species, key)
+	}
+}
+
+// Species returns the species of the live or dying cell at p, and 0 for dead cells.
+func (s *Sparse) Species(p Point) int {
+	switch {
+	case s.State(p) == StateDead:
+		return 0
+	case s.rule.Species <= 1:
+		return 1
+	default:
+		return int(s.species[packCell(p.X, p.Y, p.Z)])
+	}
+}
+
+// SetSpecies makes the cell at p alive as a member of the given species. Species the rule
+// doesn't have are ignored.
+func (s *Sparse) SetSpecies(p Point, species int) {
+	if !validSpecies(s.rule, species) {
+		return
+	}
+	s.Set(p, true)
+	if s.species != nil {
+		s.species[packCell(p.X, p.Y, p.Z)] = uint8(species)
+	}
+}
+
+// Population returns the number of live cells. Dying cells aren't counted.
+func (s *Sparse) Population() int {
+	population := 0
+	for _, state := range s.cells {
+		if state == StateAlive {
+			population++
+		}
+	}
+	return population
+}
+
+// LiveCells returns the coordinates of every live cell, sorted by x, then y, then z.
+func (s *Sparse) LiveCells() []Point {
+	keys := make([]cellKey, 0, len(s.cells))
+	for key, state := range s.cells {
+		if state == StateAlive {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	points := make([]Point, len(keys))
+	for i, key := range keys {
+		x, y, z := key.unpack()
+		points[i] = Point{x, y, z}
+	}
+	return points
+}
+
+// Rule returns the rule the world runs.
+func (s *Sparse) Rule() Rule {
+	return s.rule
+}
+
+// SetRule changes the rule used for the following generations.
+func (s *Sparse) SetRule(r Rule) error {
+	if err := CheckUnboundedRule(r); err != nil {
+		return err
+	}
+	if r.Species > 1 && s.species == nil {
+		// Every cell alive so far is of the first species
+		s.species = make(map[cellKey]uint8, len(s.cells))
+		for key := range s.cells {
+			s.species[key] = 1
+		}
+	} else if r.Species <= 1 {
+		s.species = nil
+	} else if r.Species < s.rule.Species {
+		// Cells of species the rule no longer has join the ones it does
+		for key, species := range s.species {
+			s.species[key] = foldSpecies(species, r)
+		}
+	}
+	s.rule = r
+	s.offsets = s.lattice.offsets(r.Neighborhood)
+	return nil
+}
+
+// Seed returns the seed the world rolls the dice of stochastic rules from.
+func (s *Sparse) Seed() int64 {
+	return s.seed
+}
+
+// SetSeed changes the seed the world rolls the dice of stochastic rules from.
+func (s *Sparse) SetSeed(seed int64) {
+	s.seed = seed
+}
+
+// Lattice returns how the world's cells are arranged.
+func (s *Sparse) Lattice() Lattice {
+	return s.lattice
+}
+
+// SetLattice changes how the world's cells are arranged for the following generations. Every
+// lattice can run unbounded.
+func (s *Sparse) SetLattice(l Lattice) error {
+	s.lattice = l
+	s.offsets = l.offsets(s.rule.Neighborhood)
+	return nil
+}
+
+// Step advances the world one generation. Only live and dying cells and the neighbors of
+// live cells are visited, so the cost follows the population rather than the size of the
+// universe.
+func (s *Sparse) Step() {
+	// Every live cell adds one to the count of each of its neighbors. Neighbors on a lattice
+	// touch each other, so the offsets of the live cell's row find them
+	counts := make(map[cellKey]int, len(s.cells)*len(s.offsets[0])/2)
+	for key, state := range s.cells {
+		if state != StateAlive {
+			continue
+		}
+		x, y, z := key.unpack()
+		for _, offset := range s.offsets[s.lattice.class(x, y)] {
+			counts[packCell(x+offset[0], y+offset[1], z+offset[2])]++
+		}
+	}
+
+	next := make(map[cellKey]uint8, len(s.cells))
+	for key, count := range counts {
+		if state := s.next(key, int(s.cells[key]), count); state != StateDead {
+			next[key] = uint8(state)
+		}
+	}
+	// Cells without any live neighbors never made it into counts
+	for key, state := range s.cells {
+		if _, counted := counts[key]; !counted {
+			if state := s.next(key, int(state), 0); state != StateDead {
+				next[key] = uint8(state)
+			}
+		}
+	}
+	if s.species != nil {
+		s.species = s.nextSpecies(next)
+	}
+	s.cells = next
+	s.generation++
+}
+
+// next returns the state the cell at key moves to, rolling the dice for stochastic rules.
+func (s *Sparse) next(key cellKey, state, n int) int {
+	if !s.rule.Stochastic() {
+		return s.rule.Next(state, n)
+	}
+	x, y, z := key.unpack()
+	d := newDice(s.seed, s.generation, Point{x, y, z})
+	return s.rule.nextRandom(state, n, &d)
+}
+
+// nextSpecies returns the species of the cells of the next generation. Newborn cells take the
+// species most of their live neighbors belong to, and the others keep theirs.
+func (s *Sparse) nextSpecies(next map[cellKey]uint8) map[cellKey]uint8 {
+	species := make(map[cellKey]uint8, len(next))
+	votes := newSpeciesVotes(s.rule)
+	for key := range next {
+		if _, existed := s.cells[key]; existed {
+			species[key] = s.species[key]
+			continue
+		}
+		x, y, z := key.unpack()
+		for _, offset := range s.offsets[s.lattice.class(x, y)] {
+			neighbor := packCell(x+offset[0], y+offset[1], z+offset[2])
+			if s.cells[neighbor] == StateAlive {
+				votes.add(s.species[neighbor])
+			}
+		}
+		species[key] = votes.winner(Point{x, y, z})
+	}
+	return species
+}
@@ -0,0 +1,94 @@
+package life
+
+import "math/rand"
+
+// Multispecies is a world whose live cells belong to one of the rule's species, numbered from
+// 1. Rules with one species put every live cell in species 1.
+type Multispecies interface {
+	World
+	// Species returns the species of the live or dying cell at p, and 0 for dead cells.
+	Species(p Point) int
+	// SetSpecies makes the cell at p alive as a member of the given species.
+	SetSpecies(p Point, species int)
+}
+
+// FillRandomSpecies puts every live cell of the world in a random species of its rule. The same
+// seed always gives the same species. Worlds whose rule has one species are left alone.
+func FillRandomSpecies(w Multispecies, seed int64) {
+	species := w.Rule().Species
+	if species <= 1 {
+		return
+	}
+	rnd := rand.New(rand.NewSource(seed))
+	for _, p := range w.LiveCells() {
+		w.SetSpecies(p, 1+rnd.Intn(species))
+	}
+}
+
+// speciesVotes tallies the species of a newborn cell's live neighbors.
+type speciesVotes []int
+
+func newSpeciesVotes(r Rule) speciesVotes {
+	return make(speciesVotes, max(r.Species, 1)+1)
+}
+
+// add counts a neighbor of the given species. Neighbors without a species, like the cells of an
+// alive wall, don't vote.
+func (v speciesVotes) add(species uint8) {
+	if species > 0 && int(species) < len(v) {
+		v[species]++
+	}
+}
+
+// winner returns the species most neighbors of the cell at p belong to, and clears the tally for
+// the next cell. Ties are broken by a hash of p, so no species is favored and the result doesn't
+// depend on the order cells are visited in. Without any votes the cell is species 1.
+func (v speciesVotes) winner(p Point) uint8 {
+	best, tied := 1, 0
+	for species := 1; species < len(v); species++ {
+		switch {
+		case v[species] > v[best]:
+			best, tied = species, 1
+		case v[species] == v[best]:
+			tied++
+		}
+	}
+	// Without votes every species ties, but the cell goes to the first rather than a random one
+	if tied > 1 && v[best] > 0 {
+		pick := int(hashPoint(p) % uint64(tied))
+		for species := 1; species < len(v); species++ {
+			if v[species] == v[best] {
+				if pick == 0 {
+					best = species
+					break
+				}
+				pick--
+			}
+		}
+	}
+	clear(v)
+	return uint8(best)
+}
+
+// hashPoint mixes the coordinates of p into a well spread number.
+func hashPoint(p Point) uint64 {
+	h := uint64(p.X)*0x9e3779b97f4a7c15 ^ uint64(p.Y)*0xc2b2ae3d27d4eb4f ^ uint64(p.Z)*0x165667b19e3779f9
+	h ^= h >> 31
+	h *= 0xbf58476d1ce4e5b9
+	return h ^ h>>29
+}
+
+// foldSpecies moves a cell of a species the rule no longer has, after the rule's count went down,
+// to one it does have, sharing the lost species out evenly. Other species are left as they are.
+func foldSpecies(species uint8, r Rule) uint8 {
+	count := max(r.Species, 1)
+	if int(species) <= count {
+		return species
+	}
+	return uint8((int(species)-1)%count + 1)
+}
+
+// validSpecies reports whether species is one of the rule's.
+func validSpecies(r Rule, species int) bool {
+	return species >= 1 && species <= max(r.Species, 1)
+}
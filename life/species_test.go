@@ -0,0 +1,89 @@
+package life
+
+import "testing"
+
+func TestSpeciesVotesWinner(t *testing.T) {
+	points := []Point{{0, 0, 0}, {1, 2, 3}, {-5, 7, 11}, {40, -3, 9}, {8, 8, 8}}
+	tests := []struct {
+		name  string
+		votes []uint8
+		// species the cell can go to
+		want []uint8
+	}{
+		{"no votes", nil, []uint8{1}},
+		{"votes without a species", []uint8{0, 0}, []uint8{1}},
+		{"one voter", []uint8{3}, []uint8{3}},
+		{"majority", []uint8{2, 4, 4, 1}, []uint8{4}},
+		{"tie", []uint8{2, 4, 4, 2}, []uint8{2, 4}},
+	}
+	for _, test := range tests {
+		v := newSpeciesVotes(Rule{Species: 4})
+		for _, p := range points {
+			for _, species := range test.votes {
+				v.add(species)
+			}
+			got := v.winner(p)
+			ok := false
+			for _, want := range test.want {
+				ok = ok || got == want
+			}
+			if !ok {
+				t.Errorf("%s: winner at %v is species %d, want one of %v", test.name, p, got, test.want)
+			}
+			// The same point always settles a tie the same way
+			for _, species := range test.votes {
+				v.add(species)
+			}
+			if again := v.winner(p); again != got {
+				t.Errorf("%s: winner at %v changed from %d to %d", test.name, p, got, again)
+			}
+		}
+	}
+}
+
+func TestSetRuleFewerSpecies(t *testing.T) {
+	size := Size{X: 8, Y: 9, Z: 7}
+	many, fewer := MustParseRule("B5/S4-5/K4"), MustParseRule("B5/S4-5/K3")
+	grid := soupGrid(size, many, Torus, Cubic, 3)
+	bits := NewBitGrid(size, many, Torus)
+	sparse, err := NewSparse(many)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range grid.LiveCells() {
+		bits.SetSpecies(p, grid.Species(p))
+		sparse.SetSpecies(p, grid.Species(p))
+	}
+
+	worlds := map[string]interface {
+		Multispecies
+		Rewinder
+	}{"grid": grid, "bit grid": bits, "sparse": sparse}
+	for name, w := range worlds {
+		before := make(map[Point]int)
+		for _, p := range w.LiveCells() {
+			before[p] = w.Species(p)
+		}
+		if err := w.SetRule(fewer); err != nil {
+			t.Fatal(err)
+		}
+		// The fourth species joins the first, and the others stay as they were
+		for p, species := range before {
+			want := species
+			if species == 4 {
+				want = 1
+			}
+			if got := w.Species(p); got != want {
+				t.Errorf("%s: cell %v of species %d went to species %d, want %d", name, p, species, got, want)
+			}
+		}
+		// Snapshots of the cells, like the ones sessions and rewinding keep, must restore
+		if err := w.Restore(w.Snapshot()); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+		w.Step()
+		if err := w.Restore(w.Snapshot()); err != nil {
+			t.Errorf("%s: after a step: %v", name, err)
+		}
+	}
+}
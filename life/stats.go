@@ -0,0 +1,143 @@
+package life
+
+import (
+	"math/bits"
+	"slices"
+)
+
+// Stats sums up one generation of a world.
+type Stats struct {
+	Generation int `json:"generation"`
+	// number of live cells, and how many were born and died since the generation counted before
+	Population int `json:"population"`
+	Births     int `json:"births"`
+	Deaths     int `json:"deaths"`
+	// number of groups of touching live cells, and the number of cells in the largest
+	Groups       int `json:"groups"`
+	LargestGroup int `json:"largestGroup"`
+	// GroupSizes counts the groups by size in powers of two: the first entry counts groups of 1
+	// cell, the second of 2 to 3, the third of 4 to 7 and so on up to the largest group
+	GroupSizes []int `json:"groupSizes"`
+	// corners of the smallest box holding every live cell, both the origin when there are none
+	Min Point `json:"min"`
+	Max Point `json:"max"`
+	// average coordinates of the live cells, the origin when there are none
+	Center [3]float64 `json:"center"`
+}
+
+// Census counts the stats of the generations of a world, one after another. It remembers the
+// live cells of the last generation it counted to tell births from deaths.
+type Census struct {
+	previous map[Point]bool
+}
+
+// NewCensus creates a census that hasn't counted any generation yet.
+func NewCensus() *Census {
+	return &Census{}
+}
+
+// Reset forgets the last generation counted, so the next one has no births or deaths.
+func (c *Census) Reset() {
+	c.previous = nil
+}
+
+// Count returns the stats of the current generation of the world. Births and deaths are counted
+// against the generation counted before, which is 0 of each for the first.
+func (c *Census) Count(w World) Stats {
+	cells := w.LiveCells()
+	alive := make(map[Point]bool, len(cells))
+	for _, p := range cells {
+		alive[p] = true
+	}
+
+	stats := Stats{Generation: w.Generation(), Population: len(cells)}
+	if len(cells) > 0 {
+		stats.Min, stats.Max = cells[0], cells[0]
+		for _, p := range cells {
+			stats.Min = Point{min(stats.Min.X, p.X), min(stats.Min.Y, p.Y), min(stats.Min.Z, p.Z)}
+			stats.Max = Point{max(stats.Max.X, p.X), max(stats.Max.Y, p.Y), max(stats.Max.Z, p.Z)}
+			stats.Center[0] += float64(p.X)
+			stats.Center[1] += float64(p.Y)
+			stats.Center[2] += float64(p.Z)
+		}
+		for i := range stats.Center {
+			stats.Center[i] /= float64(len(cells))
+		}
+	}
+	if c.previous != nil {
+		for p := range alive {
+			if !c.previous[p] {
+				stats.Births++
+			}
+		}
+		for p := range c.previous {
+			if !alive[p] {
+				stats.Deaths++
+			}
+		}
+	}
+	c.previous = alive
+
+	groups := Groups(w)
+	stats.Groups = len(groups)
+	if len(groups) > 0 {
+		stats.LargestGroup = slices.Max(groups)
+		stats.GroupSizes = make([]int, bits.Len(uint(stats.LargestGroup)))
+		for _, size := range groups {
+			stats.GroupSizes[bits.Len(uint(size))-1]++
+		}
+	}
+	return stats
+}
+
+// Groups returns the number of cells in each group of touching live cells, in the order of
+// GroupCells.
+func Groups(w World) []int {
+	groups := GroupCells(w)
+	sizes := make([]int, len(groups))
+	for i, cells := range groups {
+		sizes[i] = len(cells)
+	}
+	return sizes
+}
+
+// GroupCells returns the cells of each group of touching live cells, in the order of the world's
+// first live cell of each group. Cells touch when they are face neighbors on the cubic lattice,
+// or one of the 12 closest cells on the close-packed ones. Groups don't reach across the faces
+// of a box, whatever its boundary.
+func GroupCells(w World) [][]Point {
+	l := Cubic
+	if latticed, ok := w.(Latticed); ok {
+		l = latticed.Lattice()
+	}
+	touching := l.offsets(Neighborhood{Kind: VonNeumann, Radius: 1})
+
+	cells := w.LiveCells()
+	alive := make(map[Point]bool, len(cells))
+	for _, p := range cells {
+		alive[p] = true
+	}
+
+	var groups [][]Point
+	for _, start := range cells {
+		if !alive[start] {
+			continue
+		}
+		// Clear the cells of the group as they are reached, so each is only counted once. The
+		// group doubles as the queue of cells whose neighbors are still to be looked at
+		delete(alive, start)
+		group := []Point{start}
+		for i := 0; i < len(group); i++ {
+			p := group[i]
+			for _, offset := range touching[l.class(p.X, p.Y)] {
+				q := Point{p.X + offset[0], p.Y + offset[1], p.Z + offset[2]}
+				if alive[q] {
+					delete(alive, q)
+					group = append(group, q)
+				}
+			}
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
@@ -0,0 +1,169 @@
+package life
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// statsGrid returns a grid with a group of 4 cells, one of 2 and a lone cell.
+func statsGrid() *Grid {
+	g := NewGrid(Size{X: 10, Y: 10, Z: 10}, DefaultRule, MustParseBoundary("dead"))
+	for _, p := range []Point{{1, 1, 1}, {2, 1, 1}, {1, 2, 1}, {2, 2, 1}, {6, 6, 6}, {6, 6, 7}, {8, 3, 5}} {
+		g.Set(p, true)
+	}
+	return g
+}
+
+func TestCensusCount(t *testing.T) {
+	g := statsGrid()
+	c := NewCensus()
+	want := Stats{
+		Population: 7, Groups: 3, LargestGroup: 4,
+		// One group of 1 cell, one of 2 to 3 and one of 4 to 7
+		GroupSizes: []int{1, 1, 1},
+		Min:        Point{1, 1, 1}, Max: Point{8, 6, 7},
+		Center: [3]float64{26.0 / 7, 21.0 / 7, 22.0 / 7},
+	}
+	if got := c.Count(g); !reflect.DeepEqual(got, want) {
+		t.Errorf("first count is %+v, want %+v", got, want)
+	}
+
+	// The lone cell dies and a cell joins the group of 4
+	g.Set(Point{8, 3, 5}, false)
+	g.Set(Point{2, 3, 1}, true)
+	want = Stats{
+		Population: 7, Births: 1, Deaths: 1, Groups: 2, LargestGroup: 5,
+		GroupSizes: []int{0, 1, 1},
+		Min:        Point{1, 1, 1}, Max: Point{6, 6, 7},
+		Center: [3]float64{20.0 / 7, 21.0 / 7, 18.0 / 7},
+	}
+	if got := c.Count(g); !reflect.DeepEqual(got, want) {
+		t.Errorf("second count is %+v, want %+v", got, want)
+	}
+
+	// Stepping counts against the generation before
+	before := g.LiveCells()
+	g.Step()
+	after := g.LiveCells()
+	got := c.Count(g)
+	births, deaths := 0, 0
+	for _, p := range after {
+		if !slices.Contains(before, p) {
+			births++
+		}
+	}
+	for _, p := range before {
+		if !slices.Contains(after, p) {
+			deaths++
+		}
+	}
+	if got.Generation != 1 || got.Births != births || got.Deaths != deaths {
+		t.Errorf("count after a step is generation %d with %d births and %d deaths, want 1, %d and %d",
+			got.Generation, got.Births, got.Deaths, births, deaths)
+	}
+
+	// After a reset, and in an empty world, there is nothing to count
+	c.Reset()
+	empty := NewGrid(Size{X: 4, Y: 4, Z: 4}, DefaultRule, Torus)
+	if got := c.Count(empty); !reflect.DeepEqual(got, Stats{}) {
+		t.Errorf("empty world counts %+v", got)
+	}
+}
+
+func TestGroupsTouch(t *testing.T) {
+	// Cells only touching at an edge or corner are separate groups, and groups don't wrap
+	// around the faces of the box
+	tests := []struct {
+		cells []Point
+		want  []int
+	}{
+		{[]Point{{1, 1, 1}, {2, 2, 1}, {3, 3, 3}}, []int{1, 1, 1}},
+		{[]Point{{1, 1, 1}, {1, 1, 2}, {1, 1, 3}, {5, 5, 5}}, []int{1, 3}},
+		{[]Point{{0, 4, 4}, {7, 4, 4}}, []int{1, 1}},
+	}
+	for _, test := range tests {
+		g := NewGrid(Size{X: 8, Y: 8, Z: 8}, DefaultRule, Torus)
+		for _, p := range test.cells {
+			g.Set(p, true)
+		}
+		got := Groups(g)
+		slices.Sort(got)
+		if !slices.Equal(got, test.want) {
+			t.Errorf("cells %v: groups %v, want %v", test.cells, got, test.want)
+		}
+	}
+}
+
+func TestStatsWriter(t *testing.T) {
+	g := statsGrid()
+	c := NewCensus()
+	first := c.Count(g)
+	g.Set(Point{8, 3, 5}, false)
+	g.Set(Point{2, 3, 1}, true)
+	second := c.Count(g)
+	empty := c.Count(NewGrid(Size{X: 4, Y: 4, Z: 4}, DefaultRule, Torus))
+
+	var out bytes.Buffer
+	w, err := NewStatsWriter(&out, StatsCSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, stats := range []Stats{first, second, empty} {
+		if err := w.Write(stats); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// The header comes once, and every row has a value for each column
+	want := []string{
+		"generation,population,births,deaths,groups,largest_group,min_x,min_y,min_z,max_x,max_y,max_z,center_x,center_y,center_z,group_sizes",
+		"0,7,0,0,3,4,1,1,1,8,6,7,3.7143,3.0000,3.1429,1 1 1",
+		"0,7,1,1,2,5,1,1,1,6,6,7,2.8571,3.0000,2.5714,0 1 1",
+		"0,0,0,7,0,0,0,0,0,0,0,0,0.0000,0.0000,0.0000,",
+	}
+	if got := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n"); !slices.Equal(got, want) {
+		t.Errorf("CSV is %q, want %q", got, want)
+	}
+
+	out.Reset()
+	if w, err = NewStatsWriter(&out, StatsJSONL); err != nil {
+		t.Fatal(err)
+	}
+	for _, stats := range []Stats{first, second, empty} {
+		if err := w.Write(stats); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	// Empty worlds have an empty histogram rather than none
+	empty.GroupSizes = []int{}
+	scanner := bufio.NewScanner(&out)
+	for i, want := range []Stats{first, second, empty} {
+		if !scanner.Scan() {
+			t.Fatalf("JSON Lines has %d lines, want 3", i)
+		}
+		var got Stats
+		if err := json.Unmarshal(scanner.Bytes(), &got); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("JSON line %d is %+v, want %+v", i+1, got, want)
+		}
+	}
+	if scanner.Scan() {
+		t.Errorf("JSON Lines has more than 3 lines: %q", scanner.Text())
+	}
+
+	if _, err := NewStatsWriter(&out, "xml"); err == nil || err.Error() != `unknown stats format "xml", want csv or jsonl` {
+		t.Errorf("got error %v for an unknown format", err)
+	}
+}
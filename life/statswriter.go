@@ -0,0 +1,95 @@
+package life
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Formats stats can be written in
+const (
+	// StatsCSV writes a header and a row of comma separated values per generation
+	StatsCSV = "csv"
+	// StatsJSONL writes a JSON object per generation on a line of its own
+	StatsJSONL = "jsonl"
+)
+
+// statsColumns are the columns of the CSV format. The group size histogram doesn't have a fixed
+// number of entries, so its counts share the last column, separated by spaces.
+var statsColumns = []string{
+	"generation", "population", "births", "deaths", "groups", "largest_group",
+	"min_x", "min_y", "min_z", "max_x", "max_y", "max_z", "center_x", "center_y", "center_z",
+	"group_sizes",
+}
+
+// StatsWriter writes the stats of generations one after another as CSV or JSON Lines. Writes
+// are buffered until Flush.
+type StatsWriter struct {
+	csv  *csv.Writer
+	json *json.Encoder
+	// whether the CSV header has been written
+	started bool
+}
+
+// NewStatsWriter creates a stats writer for a format, StatsCSV or StatsJSONL.
+func NewStatsWriter(w io.Writer, format string) (*StatsWriter, error) {
+	s := &StatsWriter{}
+	switch format {
+	case StatsCSV:
+		s.csv = csv.NewWriter(w)
+	case StatsJSONL:
+		s.json = json.NewEncoder(w)
+	default:
+		return nil, fmt.Errorf("unknown stats format %q, want %s or %s", format, StatsCSV, StatsJSONL)
+	}
+	return s, nil
+}
+
+// Write writes the stats of one generation.
+func (s *StatsWriter) Write(stats Stats) error {
+	if s.json != nil {
+		if stats.GroupSizes == nil {
+			// Empty worlds have no groups of any size, rather than no histogram
+			stats.GroupSizes = []int{}
+		}
+		return s.json.Encode(stats)
+	}
+
+	if !s.started {
+		s.started = true
+		if err := s.csv.Write(statsColumns); err != nil {
+			return err
+		}
+	}
+	sizes := make([]string, len(stats.GroupSizes))
+	for i, count := range stats.GroupSizes {
+		sizes[i] = strconv.Itoa(count)
+	}
+	return s.csv.Write([]string{
+		strconv.Itoa(stats.Generation), strconv.Itoa(stats.Population),
+		strconv.Itoa(stats.Births), strconv.Itoa(stats.Deaths),
+		strconv.Itoa(stats.Groups), strconv.Itoa(stats.LargestGroup),
+		strconv.Itoa(stats.Min.X), strconv.Itoa(stats.Min.Y), strconv.Itoa(stats.Min.Z),
+		strconv.Itoa(stats.Max.X), strconv.Itoa(stats.Max.Y), strconv.Itoa(stats.Max.Z),
+		formatCoordinate(stats.Center[0]), formatCoordinate(stats.Center[1]), formatCoordinate(stats.Center[2]),
+		strings.Join(sizes, " "),
+	})
+}
+
+// Flush writes out any buffered stats.
+func (s *StatsWriter) Flush() error {
+	if s.csv != nil {
+		s.csv.Flush()
+		return s.csv.Error()
+	}
+	// The JSON encoder writes every generation straight through
+	return nil
+}
+
+// formatCoordinate writes a coordinate with enough digits for a cell's share of a center of mass.
+func formatCoordinate(v float64) string {
+	return strconv.FormatFloat(v, 'f', 4, 64)
+}
@@ -0,0 +1,215 @@
+package life
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image/color"
+	"io"
+)
+
+// maxVoxSide is the most voxels a MagicaVoxel model can have along an axis, since their
+// coordinates are single bytes.
+const maxVoxSide = 256
+
+// voxVersion is the version of the format written, which every MagicaVoxel release reads.
+const voxVersion = 150
+
+// Vox is a model of a MagicaVoxel .vox file: a box of voxels, each painted with a color of a 256
+// color palette. Its sizes and coordinates are in the axes of the cells, with Y up, rather than
+// MagicaVoxel's, with Z up.
+type Vox struct {
+	Size   Size
+	Voxels []Voxel
+	// Palette is the color of each palette index. Index 0 means no voxel and is never used.
+	Palette [256]color.RGBA
+}
+
+// Voxel is a filled cell of a model and the index of its color in the palette, from 1 to 255.
+type Voxel struct {
+	Point
+	Index uint8
+}
+
+// DefaultVoxPalette returns the palette MagicaVoxel gives models that don't have their own: a
+// cube of web colors followed by ramps of red, green, blue and gray.
+func DefaultVoxPalette() [256]color.RGBA {
+	var palette [256]color.RGBA
+	levels := []uint8{0xff, 0xcc, 0x99, 0x66, 0x33, 0x00}
+	i := 1
+	for _, r := range levels {
+		for _, g := range levels {
+			for _, b := range levels {
+				// Black is left to the gray ramp
+				if r == 0 && g == 0 && b == 0 {
+					continue
+				}
+				palette[i] = color.RGBA{r, g, b, 0xff}
+				i++
+			}
+		}
+	}
+	ramp := []uint8{0xee, 0xdd, 0xbb, 0xaa, 0x88, 0x77, 0x55, 0x44, 0x22, 0x11}
+	for channel := 0; channel < 4; channel++ {
+		for _, v := range ramp {
+			c := color.RGBA{A: 0xff}
+			switch channel {
+			case 0:
+				c.R = v
+			case 1:
+				c.G = v
+			case 2:
+				c.B = v
+			default:
+				c.R, c.G, c.B = v, v, v
+			}
+			palette[i] = c
+			i++
+		}
+	}
+	return palette
+}
+
+// ReadVox reads the first model of a MagicaVoxel .vox file, along with its palette. Files with
+// several models, like scenes, only give their first.
+func ReadVox(r io.Reader) (Vox, error) {
+	v := Vox{Palette: DefaultVoxPalette()}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return v, err
+	}
+	if len(data) < 8 || string(data[:4]) != "VOX " {
+		return v, errors.New("vox: not a MagicaVoxel file, it doesn't start with VOX")
+	}
+	id, _, children, _, err := readVoxChunk(data[8:])
+	if err != nil {
+		return v, err
+	}
+	if id != "MAIN" {
+		return v, fmt.Errorf("vox: expected the MAIN chunk, got %q", id)
+	}
+
+	sized, filled := false, false
+	for rest := children; len(rest) > 0; {
+		id, content, _, next, err := readVoxChunk(rest)
+		if err != nil {
+			return v, err
+		}
+		rest = next
+		switch {
+		case id == "SIZE" && !sized:
+			if len(content) < 12 {
+				return v, errors.New("vox: SIZE chunk is too short")
+			}
+			x, y, z := voxInt(content[0:]), voxInt(content[4:]), voxInt(content[8:])
+			if x < 1 || y < 1 || z < 1 || x > maxVoxSide || y > maxVoxSide || z > maxVoxSide {
+				return v, fmt.Errorf("vox: model size %dx%dx%d must be from 1 to %d along each axis", x, y, z, maxVoxSide)
+			}
+			v.Size = Size{X: x, Y: z, Z: y}
+			sized = true
+		case id == "XYZI" && sized && !filled:
+			if len(content) < 4 {
+				return v, errors.New("vox: XYZI chunk is too short")
+			}
+			count := voxInt(content)
+			if count < 0 || count > (len(content)-4)/4 {
+				return v, fmt.Errorf("vox: XYZI chunk claims %d voxels but only has room for %d", count, (len(content)-4)/4)
+			}
+			v.Voxels = make([]Voxel, 0, count)
+			for i := 0; i < count; i++ {
+				b := content[4+4*i:]
+				x, y, z, index := int(b[0]), int(b[1]), int(b[2]), b[3]
+				if x >= v.Size.X || y >= v.Size.Z || z >= v.Size.Y {
+					return v, fmt.Errorf("vox: voxel %d,%d,%d is outside the %dx%dx%d model", x, y, z, v.Size.X, v.Size.Z, v.Size.Y)
+				}
+				if index == 0 {
+					return v, fmt.Errorf("vox: voxel %d,%d,%d has color index 0", x, y, z)
+				}
+				v.Voxels = append(v.Voxels, Voxel{Point: Point{X: x, Y: z, Z: v.Size.Z - 1 - y}, Index: index})
+			}
+			filled = true
+		case id == "RGBA":
+			if len(content) < 4*255 {
+				return v, errors.New("vox: RGBA chunk is too short")
+			}
+			// The chunk's first color is index 1
+			for i := 0; i < 255; i++ {
+				c := content[4*i:]
+				v.Palette[i+1] = color.RGBA{c[0], c[1], c[2], c[3]}
+			}
+		}
+		// PACK, scene, layer and material chunks don't change the cells
+	}
+	if !filled {
+		return v, errors.New("vox: file has no model, it needs SIZE and XYZI chunks")
+	}
+	return v, nil
+}
+
+// readVoxChunk splits a chunk off the front of data: its id, content and children, and what
+// follows it.
+func readVoxChunk(data []byte) (id string, content, children, rest []byte, err error) {
+	if len(data) < 12 {
+		return "", nil, nil, nil, errors.New("vox: file ends in the middle of a chunk header")
+	}
+	id = string(data[:4])
+	contentSize, childrenSize := voxInt(data[4:]), voxInt(data[8:])
+	data = data[12:]
+	if contentSize < 0 || childrenSize < 0 || contentSize > len(data) || childrenSize > len(data)-contentSize {
+		return "", nil, nil, nil, fmt.Errorf("vox: %q chunk is longer than the file", id)
+	}
+	return id, data[:contentSize], data[contentSize : contentSize+childrenSize], data[contentSize+childrenSize:], nil
+}
+
+// voxInt reads one of the little endian 32 bit integers of the format.
+func voxInt(b []byte) int {
+	return int(int32(binary.LittleEndian.Uint32(b)))
+}
+
+// WriteVox writes a model as a MagicaVoxel .vox file with its palette.
+func WriteVox(w io.Writer, v Vox) error {
+	if v.Size.X < 1 || v.Size.Y < 1 || v.Size.Z < 1 || v.Size.X > maxVoxSide || v.Size.Y > maxVoxSide || v.Size.Z > maxVoxSide {
+		return fmt.Errorf("vox: model size %dx%dx%d must be from 1 to %d along each axis", v.Size.X, v.Size.Y, v.Size.Z, maxVoxSide)
+	}
+	var size, voxels, palette bytes.Buffer
+	for _, n := range []int{v.Size.X, v.Size.Z, v.Size.Y} {
+		binary.Write(&size, binary.LittleEndian, int32(n))
+	}
+	binary.Write(&voxels, binary.LittleEndian, int32(len(v.Voxels)))
+	for _, voxel := range v.Voxels {
+		p := voxel.Point
+		if p.X < 0 || p.Y < 0 || p.Z < 0 || p.X >= v.Size.X || p.Y >= v.Size.Y || p.Z >= v.Size.Z {
+			return fmt.Errorf("vox: voxel %d,%d,%d is outside the %dx%dx%d model", p.X, p.Y, p.Z, v.Size.X, v.Size.Y, v.Size.Z)
+		}
+		if voxel.Index == 0 {
+			return fmt.Errorf("vox: voxel %d,%d,%d has color index 0", p.X, p.Y, p.Z)
+		}
+		voxels.Write([]byte{byte(p.X), byte(v.Size.Z - 1 - p.Z), byte(p.Y), voxel.Index})
+	}
+	for i := 1; i <= 256; i++ {
+		// The chunk has room for 256 colors but only indices 1 to 255 are used
+		c := v.Palette[i%256]
+		palette.Write([]byte{c.R, c.G, c.B, c.A})
+	}
+
+	var children bytes.Buffer
+	writeVoxChunk(&children, "SIZE", size.Bytes(), nil)
+	writeVoxChunk(&children, "XYZI", voxels.Bytes(), nil)
+	writeVoxChunk(&children, "RGBA", palette.Bytes(), nil)
+	var file bytes.Buffer
+	file.WriteString("VOX ")
+	binary.Write(&file, binary.LittleEndian, int32(voxVersion))
+	writeVoxChunk(&file, "MAIN", nil, children.Bytes())
+	_, err := w.Write(file.Bytes())
+	return err
+}
+
+// writeVoxChunk writes a chunk with its content and children.
+func writeVoxChunk(b *bytes.Buffer, id string, content, children []byte) {
+	b.WriteString(id)
+	binary.Write(b, binary.LittleEndian, int32(len(content)))
+	binary.Write(b, binary.LittleEndian, int32(len(children)))
+	b.Write(content)
+	b.Write(children)
+}
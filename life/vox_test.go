@@ -0,0 +1,161 @@
+package life
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image/color"
+	"slices"
+	"testing"
+)
+
+// testVox returns a small model with voxels in its corners and custom colors.
+func testVox() Vox {
+	v := Vox{Size: Size{X: 3, Y: 4, Z: 2}, Palette: DefaultVoxPalette()}
+	v.Palette[1] = color.RGBA{10, 20, 30, 255}
+	v.Palette[255] = color.RGBA{200, 100, 50, 128}
+	v.Voxels = []Voxel{
+		{Point{0, 0, 0}, 1},
+		{Point{2, 0, 0}, 2},
+		{Point{0, 3, 0}, 17},
+		{Point{0, 0, 1}, 128},
+		{Point{2, 3, 1}, 255},
+	}
+	return v
+}
+
+// voxFile writes a .vox file from raw chunks, each given as its id and content.
+func voxFile(chunks ...string) []byte {
+	var children bytes.Buffer
+	for _, chunk := range chunks {
+		writeVoxChunk(&children, chunk[:4], []byte(chunk[4:]), nil)
+	}
+	var file bytes.Buffer
+	file.WriteString("VOX ")
+	binary.Write(&file, binary.LittleEndian, int32(voxVersion))
+	writeVoxChunk(&file, "MAIN", nil, children.Bytes())
+	return file.Bytes()
+}
+
+// voxInts writes little endian 32 bit integers.
+func voxInts(values ...int) string {
+	var b []byte
+	for _, v := range values {
+		b = binary.LittleEndian.AppendUint32(b, uint32(int32(v)))
+	}
+	return string(b)
+}
+
+func TestVoxRoundTrip(t *testing.T) {
+	want := testVox()
+	var file bytes.Buffer
+	if err := WriteVox(&file, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadVox(&file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Size != want.Size || !slices.Equal(got.Voxels, want.Voxels) || got.Palette != want.Palette {
+		t.Errorf("model read back as %+v, want %+v", got, want)
+	}
+}
+
+func TestVoxAxes(t *testing.T) {
+	// MagicaVoxel has Z up and Y going into the screen, the cells Y up and Z coming out of it. A
+	// model 3 wide, 2 deep and 4 high has its voxel at x 1, y 0, z 2 in the cell at 1, 2, 1.
+	data := voxFile("SIZE"+voxInts(3, 2, 4), "XYZI"+voxInts(1)+"\x01\x00\x02\x07")
+	v, err := ReadVox(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (Size{X: 3, Y: 4, Z: 2}); v.Size != want {
+		t.Errorf("model size %v, want %v", v.Size, want)
+	}
+	if want := []Voxel{{Point{1, 2, 1}, 7}}; !slices.Equal(v.Voxels, want) {
+		t.Errorf("voxels %v, want %v", v.Voxels, want)
+	}
+	// Files without a palette get MagicaVoxel's
+	if v.Palette != DefaultVoxPalette() {
+		t.Error("model without an RGBA chunk has another palette than the default")
+	}
+	palette := DefaultVoxPalette()
+	if palette[0] != (color.RGBA{}) || palette[1] != (color.RGBA{255, 255, 255, 255}) || palette[215] != (color.RGBA{0, 0, 51, 255}) || palette[255] != (color.RGBA{17, 17, 17, 255}) {
+		t.Errorf("default palette has colors %v, %v, %v and %v", palette[0], palette[1], palette[215], palette[255])
+	}
+
+	// The RGBA chunk's first color is index 1
+	rgba := make([]byte, 4*256)
+	rgba[0], rgba[4*254] = 9, 99
+	data = voxFile("SIZE"+voxInts(1, 1, 1), "XYZI"+voxInts(1)+"\x00\x00\x00\x01", "RGBA"+string(rgba))
+	if v, err = ReadVox(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if v.Palette[1].R != 9 || v.Palette[255].R != 99 {
+		t.Errorf("palette indices 1 and 255 are %v and %v", v.Palette[1], v.Palette[255])
+	}
+}
+
+func TestReadVoxErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"not vox", []byte("PNG whatever"), "vox: not a MagicaVoxel file, it doesn't start with VOX"},
+		{"no main", append([]byte("VOX \x96\x00\x00\x00"), "PACK"+voxInts(0, 0)...), `vox: expected the MAIN chunk, got "PACK"`},
+		{"cut header", voxFile()[:14], "vox: file ends in the middle of a chunk header"},
+		{"long chunk", append([]byte("VOX \x96\x00\x00\x00"), "MAIN"+voxInts(0, 1000)...), `vox: "MAIN" chunk is longer than the file`},
+		{"negative chunk", append([]byte("VOX \x96\x00\x00\x00"), "MAIN"+voxInts(-1, 0)...), `vox: "MAIN" chunk is longer than the file`},
+		{"no model", voxFile(), "vox: file has no model, it needs SIZE and XYZI chunks"},
+		{"voxels before size", voxFile("XYZI" + voxInts(0)), "vox: file has no model, it needs SIZE and XYZI chunks"},
+		{"short size", voxFile("SIZE" + voxInts(1, 1)), "vox: SIZE chunk is too short"},
+		{"zero size", voxFile("SIZE" + voxInts(0, 1, 1)), "vox: model size 0x1x1 must be from 1 to 256 along each axis"},
+		{"huge size", voxFile("SIZE" + voxInts(1, 257, 1)), "vox: model size 1x257x1 must be from 1 to 256 along each axis"},
+		{"short voxels", voxFile("SIZE"+voxInts(1, 1, 1), "XYZI"), "vox: XYZI chunk is too short"},
+		{"too many voxels", voxFile("SIZE"+voxInts(1, 1, 1), "XYZI"+voxInts(2)+"\x00\x00\x00\x01"), "vox: XYZI chunk claims 2 voxels but only has room for 1"},
+		{"negative voxels", voxFile("SIZE"+voxInts(1, 1, 1), "XYZI"+voxInts(-1)), "vox: XYZI chunk claims -1 voxels but only has room for 0"},
+		{"voxel outside", voxFile("SIZE"+voxInts(2, 2, 2), "XYZI"+voxInts(1)+"\x00\x02\x00\x01"), "vox: voxel 0,2,0 is outside the 2x2x2 model"},
+		{"voxel without color", voxFile("SIZE"+voxInts(2, 2, 2), "XYZI"+voxInts(1)+"\x01\x01\x01\x00"), "vox: voxel 1,1,1 has color index 0"},
+		{"short palette", voxFile("SIZE"+voxInts(1, 1, 1), "XYZI"+voxInts(0), "RGBA\x00"), "vox: RGBA chunk is too short"},
+	}
+	for _, test := range tests {
+		_, err := ReadVox(bytes.NewReader(test.data))
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+func FuzzReadVox(f *testing.F) {
+	var file bytes.Buffer
+	if err := WriteVox(&file, testVox()); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(file.Bytes())
+	f.Add(voxFile("SIZE"+voxInts(3, 2, 4), "XYZI"+voxInts(1)+"\x01\x00\x02\x07"))
+	f.Add(voxFile("PACK"+voxInts(1), "SIZE"+voxInts(1, 1, 1), "XYZI"+voxInts(1)+"\x00\x00\x00\x01", "nTRN"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		v, err := ReadVox(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+		// Whatever reads is a model the writer takes, and reads back the same
+		for _, voxel := range v.Voxels {
+			p := voxel.Point
+			if p.X < 0 || p.Y < 0 || p.Z < 0 || p.X >= v.Size.X || p.Y >= v.Size.Y || p.Z >= v.Size.Z || voxel.Index == 0 {
+				t.Fatalf("voxel %v lies outside the %v model or has no color", voxel, v.Size)
+			}
+		}
+		var file bytes.Buffer
+		if err := WriteVox(&file, v); err != nil {
+			t.Fatalf("model read can't be written: %v", err)
+		}
+		again, err := ReadVox(&file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again.Size != v.Size || !slices.Equal(again.Voxels, v.Voxels) || again.Palette != v.Palette {
+			t.Fatalf("model %+v wrote and read back as %+v", v, again)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+// Package life simulates 3D life-like cellular automata. It has no rendering dependencies,
+// so simulations can be driven from tests, servers and batch tools as well as the bubblelife
+// window.
+package life
+
+import "math/rand"
+
+// Point is the coordinates of a cell. Y is the up axis.
+type Point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+	Z int `json:"z"`
+}
+
+// Size is the number of cells along each axis of a box.
+type Size struct {
+	X, Y, Z int
+}
+
+// Cells returns the number of cells in a box of this size.
+func (s Size) Cells() int {
+	return s.X * s.Y * s.Z
+}
+
+// World is a 3D universe of cells that advances one generation at a time.
+type World interface {
+	// Step advances the world one generation.
+	Step()
+	// Generation returns how many generations the world has advanced.
+	Generation() int
+	// Alive reports whether the cell at p is alive.
+	Alive(p Point) bool
+	// State returns the state of the cell at p: StateDead, StateAlive or one of the dying
+	// states of a Generations rule.
+	State(p Point) int
+	// Set makes the cell at p alive or dead.
+	Set(p Point, alive bool)
+	// Population returns the number of live cells.
+	Population() int
+	// LiveCells returns the coordinates of every live cell, in the same order every call.
+	LiveCells() []Point
+	// Rule returns the rule the world runs.
+	Rule() Rule
+	// SetRule changes the rule used for the following generations.
+	SetRule(r Rule) error
+}
+
+// Bounded is a world limited to a box, with a boundary deciding what lies past its faces.
+type Bounded interface {
+	World
+	// Size returns the size of the box.
+	Size() Size
+	// Boundary returns what lies past the faces of the box.
+	Boundary() Boundary
+	// SetBoundary changes what lies past the faces for the following generations.
+	SetBoundary(b Boundary)
+}
+
+// Seeded is a world that rolls the dice of stochastic rules from a seed. The same seed, starting
+// cells and rule always give the same run.
+type Seeded interface {
+	World
+	// Seed returns the seed the dice are rolled from.
+	Seed() int64
+	// SetSeed changes the seed the dice are rolled from.
+	SetSeed(seed int64)
+}
+
+// Latticed is a world whose cells can be arranged on other lattices than the simple cubic
+// one.
+type Latticed interface {
+	World
+	// Lattice returns how the cells are arranged.
+	Lattice() Lattice
+	// SetLattice changes how the cells are arranged for the following generations.
+	SetLattice(l Lattice) error
+}
+
+// FillRandom makes each cell in the box from the origin to size alive with the given
+// probability. The same seed always gives the same cells.
+func FillRandom(w World, size Size, density float32, seed int64) {
+	rnd := rand.New(rand.NewSource(seed))
+	for x := 0; x < size.X; x++ {
+		for y := 0; y < size.Y; y++ {
+			for z := 0; z < size.Z; z++ {
+				w.Set(Point{x, y, z}, rnd.Float32() < density)
+			}
+		}
+	}
+}
@@ -3,13 +3,18 @@ package main
 import (
 	"bytes"
 	_ "embed"
+	"errors"
+	"flag"
+	"fmt"
 	"image"
+	"io"
 	"log"
 	"math"
-	"math/rand"
+	"os"
 	"runtime"
 	"unsafe"
 
+	"github.com/braheezy/bubblelife/life"
 	_ "github.com/mdouchement/hdr/codec/rgbe"
 
 	"github.com/go-gl/gl/v4.1-core/gl"
@@ -29,8 +34,40 @@ const (
 	animationSpeed = 3.0
 	// resolution to use for background
 	resolution = int32(4096)
+	// how much of their radius and color dying bubbles have lost just before they die
+	dyingShrink = 0.7
+	dyingFade   = 0.6
+	// longest oscillator period the pillar is watched for
+	maxDetectedPeriod = 30
+	// most past generations kept to step back to
+	maxHistory = 256
 )
 
+// The kinds of universe. The pillar stores a bool per cell, the packed pillar stores a bit per
+// cell and counts neighbors 64 cells at a time, and the infinite universe only stores live cells.
+// The hashlife universe is infinite too, but remembers how every cube of space evolves so it can
+// skip far ahead. The lenia universe is a pillar of continuous cells, which don't follow the rule.
+const (
+	universePillar   = "pillar"
+	universePacked   = "packed"
+	universeInfinite = "infinite"
+	universeHashLife = "hashlife"
+	universeLenia    = "lenia"
+)
+
+var universes = []string{universePillar, universePacked, universeInfinite, universeHashLife, universeLenia}
+
+// What happens when the world dies out, freezes into a still life or gets stuck oscillating:
+// nothing, pause, start over with the next seed, or switch to the next rule preset.
+const (
+	stagnationNone   = "none"
+	stagnationPause  = "pause"
+	stagnationReseed = "reseed"
+	stagnationRule   = "rule"
+)
+
+var stagnationActions = []string{stagnationNone, stagnationPause, stagnationReseed, stagnationRule}
+
 var (
 	// Track time stats related to frame speed to account for different computer performance
 	// time between current frame and last frame
@@ -56,12 +93,30 @@ var (
 	lastGenerationTime float64
 
 	// scene settings
-	generation      int
 	initialSeed     = int64(42)
 	pillarN         = 10
 	pillarM         = 20
+	pillarK         = 10
 	bubbles         []*Bubble
 	generationSpeed = 5.0
+	rule            = life.DefaultRule
+	boundary        = life.Torus
+	leniaParams     = life.DefaultLeniaParams
+	// the pattern new worlds start from
+	seeder = life.DefaultSeeder
+	// how the cells are arranged in space
+	lattice = life.Cubic
+	// which universe the bubbles show, one of universes
+	universe = universePillar
+	// what to do once the world settles, one of stagnationActions
+	onStagnation = stagnationNone
+	// paused worlds don't advance on their own
+	paused bool
+
+	// the simulation the bubbles show, what it has settled into, and its last generations
+	world    life.World
+	detector = life.NewDetector(maxDetectedPeriod)
+	history  = life.NewHistory(maxHistory)
 )
 
 func init() {
@@ -123,6 +178,27 @@ func initGL() *glfw.Window {
 }
 
 func main() {
+	// The subcommands run without a window
+	if len(os.Args) > 1 {
+		subcommands := map[string]func([]string, io.Writer) error{
+			"sim":     runSim,
+			"explore": runExplore,
+		}
+		if run, ok := subcommands[os.Args[1]]; ok {
+			if err := run(os.Args[2:], os.Stdout); err != nil && !errors.Is(err, flag.ErrHelp) {
+				log.Fatal(err)
+			}
+			return
+		}
+	}
+
+	if err := parseSettings(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return
+		}
+		log.Fatal(err)
+	}
+
 	window := initGL()
 
 	//* Load shaders
@@ -143,34 +219,45 @@ func main() {
 	hdrTexture := loadHDRTexture()
 	envCubemap := setupCubemap(hdrTexture, equirectangularToCubemapShader)
 	// Create pillar of bubbles (positions only)
-	bubbles = createPillarOfBubbles(pillarN, pillarM, bubbleSpacing, initialSeed)
+	bubbles, err = createBubbles(pillarN, pillarM, pillarK, initialSeed)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if statsPath != "" {
+		if err := openStatsFile(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	restartStats()
 
 	// Init buffers for bubble positions
 	initInstanceBuffer(bubbles)
 
-	// calculate sane starting camera position based on pillar size
-	pillarWidth := (float32(pillarN) - 1) * bubbleSpacing
-	pillarHeight := (float32(pillarM) - 1) * bubbleSpacing
-	pillarDepth := (float32(pillarN) - 1) * bubbleSpacing
-	maxDimension := pillarWidth
-	if pillarHeight > maxDimension {
-		maxDimension = pillarHeight
-	}
-	if pillarDepth > maxDimension {
-		maxDimension = pillarDepth
-	}
+	// calculate sane starting camera position based on pillar size, up to the center of the far
+	// corner of the lattice
+	corner := lattice.Position(life.Point{X: pillarN - 1, Y: pillarM - 1, Z: pillarK - 1})
+	pillarWidth := float32(corner[0]) * bubbleSpacing
+	pillarHeight := float32(corner[1]) * bubbleSpacing
+	pillarDepth := float32(corner[2]) * bubbleSpacing
 	// Field of view (in radians) and aspect ratio
 	fov := mgl32.DegToRad(45.0) // Assuming the FOV is 45 degrees
 	aspectRatio := float32(windowWidth) / float32(windowHeight)
-	// Calculate the distance from the center of the pillar to the camera
-	// Based on the formula: distance = (maxDimension / 2) / tan(fov / 2)
-	distance := (maxDimension / 2) / float32(math.Tan(float64(fov)/2))
+	// Frame the sphere around the whole pillar, so slabs, tubes and cubes all fit. The sphere fits
+	// the view when its radius fills half the field of view: distance = radius / sin(fov / 2)
+	radius := mgl32.Vec3{pillarWidth, pillarHeight, pillarDepth}.Len() / 2
+	distance := radius / float32(math.Sin(float64(fov)/2))
 	if aspectRatio < 1.0 {
-		// If the window is taller than wide, increase the distance to fit the height
+		// If the window is taller than wide, increase the distance to fit the width
 		distance /= aspectRatio
 	}
-	cameraPos := mgl32.Vec3{pillarWidth / 2, pillarHeight / 2, distance / 2}
+	cameraPos := mgl32.Vec3{pillarWidth / 2, pillarHeight / 2, pillarDepth/2 + distance}
 	camera = NewDefaultCameraAtPosition(cameraPos)
+	// A loaded session brings back its own cells and camera
+	if startSession != nil {
+		if err := restoreSession(*startSession); err != nil {
+			log.Fatal(err)
+		}
+	}
 
 	// Setup view/projection matrices
 	projection := mgl32.Perspective(mgl32.DegToRad(45.0), windowWidth/windowHeight, 0.1, 100.0)
@@ -198,6 +285,7 @@ func main() {
 
 	textRenderer := NewTextRenderer(windowWidth, windowHeight)
 	textRenderer.Load("fonts/ocraext.ttf", 24)
+	graphRenderer := NewGraphRenderer(windowWidth, windowHeight)
 
 	//* render loop
 	for !window.ShouldClose() {
@@ -217,26 +305,52 @@ func main() {
 
 		processInput(window)
 
-		// update generation if enough time has passed
-		if currentFrame-lastGenerationTime >= generationSpeed {
-			updateGameOfLife(bubbles, pillarN, pillarM)
+		// go back to earlier generations when asked to, dropping any steps still to come
+		if rewindGenerations > 0 {
+			if rewind(rewindGenerations) {
+				showGeneration()
+				recordStats()
+			}
+			rewindGenerations, stepGenerations = 0, 0
+		}
+
+		// update generation if enough time has passed, or step or jump ahead when asked to
+		if (!paused && currentFrame-lastGenerationTime >= generationSpeed) || skipGenerations > 0 || stepGenerations > 0 {
+			if rewinder, ok := world.(life.Rewinder); ok {
+				history.Push(rewinder.Snapshot())
+			}
+			if skipGenerations > 0 {
+				life.Advance(world, skipGenerations)
+				skipGenerations = 0
+			} else {
+				world.Step()
+				stepGenerations = max(stepGenerations-1, 0)
+			}
+			showGeneration()
+			recordStats()
 			lastGenerationTime = currentFrame
-			generation++
 
-			// The goal is to find populations of bubbles and give them the same color. It's not great but
-			// results in a visually pleasing effect
-			numGroups := findGroups(bubbles, pillarN, pillarM, bubbleSpacing)
-			assignColorsToGroups(bubbles, numGroups)
-			updateColorBuffer(bubbles)
+			// React once when the world settles down
+			wasSettled := detector.Verdict().Settled()
+			if verdict := detector.Observe(world); verdict.Settled() && !wasSettled {
+				respondToStagnation()
+			}
 		}
 
 		// "alive" and "dead" is transitioned by growing/shrinking the radius of the bubble. that animation can happen
 		// over multiple frames, so update that here.
 		animateBubbleRadius(bubbles, deltaTime)
+		if universe == universeInfinite || universe == universeHashLife {
+			// Bubbles of dead cells go away once they have shrunk
+			var pruned bool
+			if bubbles, pruned = pruneBubbles(bubbles); pruned {
+				initInstanceBuffer(bubbles)
+			}
+		}
 		updateRadiiBuffer(bubbles)
 		aliveCount := 0
 		for _, bubble := range bubbles {
-			if bubble.CurrentState && bubble.Radius > 0.0 {
+			if bubble.CurrentState && bubble.Dying == 0.0 && bubble.Radius > 0.0 {
 				aliveCount++
 			}
 		}
@@ -263,12 +377,16 @@ func main() {
 
 		if showUI {
 			// draw all UI elements
-			renderUI(textRenderer, bubbles, fps, aliveCount, generation)
+			renderUI(textRenderer, bubbles, fps, aliveCount, world.Generation(), detector.Verdict())
+			renderGraph(textRenderer, graphRenderer, recorded)
 		}
 
 		window.SwapBuffers()
 	}
 	glfw.Terminate()
+	if err := closeStatsFile(); err != nil {
+		log.Fatal(err)
+	}
 }
 
 func setupCubemap(textureID uint32, equirectangularToCubemapShader *Shader) uint32 {
@@ -425,119 +543,56 @@ func renderCube() {
 	gl.BindVertexArray(0)
 }
 
-func countAliveNeighbors(bubbles []*Bubble, N, M int, x, y, z int) int {
-	aliveNeighbors := 0
-
-	// Iterate through all possible neighbor coordinates (-1, 0, 1) for x, y, z
-	for dx := -1; dx <= 1; dx++ {
-		for dy := -1; dy <= 1; dy++ {
-			for dz := -1; dz <= 1; dz++ {
-				// Skip the bubble itself (dx, dy, dz all zero)
-				if dx == 0 && dy == 0 && dz == 0 {
-					continue
-				}
-
-				// Calculate neighbor coordinates with wrapping
-				nx := (x + dx + N) % N // Wrap around for x-axis
-				ny := (y + dy + M) % M // Wrap around for y-axis
-				nz := (z + dz + N) % N // Wrap around for z-axis
-
-				// Calculate the index of the neighbor
-				neighborIndex := (nx * M * N) + (ny * N) + nz
-
-				// Count alive neighbors
-				if bubbles[neighborIndex].CurrentState {
-					aliveNeighbors++
-				}
-			}
-		}
-	}
-
-	return aliveNeighbors
-}
-
-func updateGameOfLife(bubbles []*Bubble, N, M int) {
-	// Apply Game of Life rules for 3D
-	for x := 0; x < N; x++ {
-		for y := 0; y < M; y++ {
-			for z := 0; z < N; z++ {
-				index := (x * M * N) + (y * N) + z
-				bubble := bubbles[index]
-
-				aliveNeighbors := countAliveNeighbors(bubbles, N, M, x, y, z)
-
-				if bubble.CurrentState {
-					// Apply 3D GoL rules for alive cells
-					if aliveNeighbors < 4 || aliveNeighbors > 9 {
-						bubble.NextState = false // Cell dies
-					} else {
-						bubble.NextState = true // Cell survives
-					}
-				} else {
-					// Apply 3D GoL rules for dead cells
-					if aliveNeighbors >= 5 && aliveNeighbors <= 7 {
-						bubble.NextState = true // Cell is born
-					}
-				}
-			}
-		}
-	}
-}
-
 // Function to animate radius changes
 func animateBubbleRadius(bubbles []*Bubble, deltaTime float64) {
 	for _, bubble := range bubbles {
-		// Check if there's a state change that needs to be animated
-		if bubble.CurrentState != bubble.NextState {
-			bubble.Animating = true
-		}
+		// Check if there's a radius change that needs to be animated. Dying bubbles shrink in steps
+		// while staying alive
+		target := bubble.targetRadius()
+		bubble.Animating = bubble.Radius != target || bubble.CurrentState != bubble.NextState
 
 		// Animate based on the state change
 		if bubble.Animating {
-			if bubble.NextState && bubble.Radius < 1.0 {
+			if bubble.Radius < target {
 				// Growing animation
-				bubble.Radius += float32(deltaTime * animationSpeed)
-				if bubble.Radius >= 1.0 {
-					bubble.Radius = 1.0
-					bubble.CurrentState = true // Commit the new state
-					bubble.Animating = false
-				}
-			} else if !bubble.NextState && bubble.Radius > 0.0 {
+				bubble.Radius = min(target, bubble.Radius+float32(deltaTime*animationSpeed))
+			} else if bubble.Radius > target {
 				// Shrinking animation
-				bubble.Radius -= float32(deltaTime * animationSpeed)
-				if bubble.Radius <= 0.0 {
-					bubble.Radius = 0.0
-					bubble.CurrentState = false // Commit the new state
-					bubble.Animating = false
-				}
+				bubble.Radius = max(target, bubble.Radius-float32(deltaTime*animationSpeed))
+			}
+			if bubble.Radius == target {
+				bubble.CurrentState = bubble.NextState // Commit the new state
+				bubble.Animating = false
 			}
 		}
 	}
 }
 
-// createPillarOfBubbles generates an NxN grid of bubbles stacked vertically into a pillar.
-func createPillarOfBubbles(N, M int, spacing float32, seed int64) []*Bubble {
-	bubbles := make([]*Bubble, 0)
-
-	rnd := rand.New(rand.NewSource(seed))
+// createPillarOfBubbles generates a bubble for every cell of the grid, which is an NxK grid stacked
+// vertically into a pillar.
+func createPillarOfBubbles(grid life.World, size life.Size, spacing float32) []*Bubble {
+	bubbles := make([]*Bubble, 0, size.Cells())
+	bubbleIndex = make(map[life.Point]*Bubble, size.Cells())
+	continuous, isContinuous := grid.(life.Continuous)
 
 	// Iterate through the grid to create bubbles at specific positions
-	for x := 0; x < N; x++ {
-		for y := 0; y < M; y++ {
-			for z := 0; z < N; z++ {
-				position := mgl32.Vec3{
-					float32(x) * spacing,
-					float32(y) * spacing,
-					float32(z) * spacing,
-				}
-
+	for x := 0; x < size.X; x++ {
+		for y := 0; y < size.Y; y++ {
+			for z := 0; z < size.Z; z++ {
 				// Create a new bubble with a default radius (not used in shaders, just kept for logical structure)
-				bubble := NewBubble(position)
-
-				if rnd.Float32() < 0.4 {
+				bubble := newCellBubble(life.Point{X: x, Y: y, Z: z}, spacing)
+
+				if isContinuous {
+					// Continuous cells show their value
+					bubble.Value = float32(continuous.Value(bubble.Cell))
+					bubble.CurrentState = bubble.Value > 0.0
+					bubble.NextState = bubble.CurrentState
+					bubble.Radius = bubble.Value
+				} else if grid.Alive(bubble.Cell) {
 					bubble.CurrentState = true
 					bubble.NextState = true
 					bubble.Radius = 1.0
+					bubble.Species = cellSpecies(grid, bubble.Cell)
 				}
 
 				bubbles = append(bubbles, bubble)
@@ -545,7 +600,7 @@ func createPillarOfBubbles(N, M int, spacing float32, seed int64) []*Bubble {
 		}
 	}
 
-	numGroups := findGroups(bubbles, N, M, spacing)
+	numGroups := findGroups(bubbles, size.X, size.Y, spacing)
 
 	// 2. Assign colors to each group of bubbles
 	assignColorsToGroups(bubbles, numGroups)
@@ -585,11 +640,240 @@ func mouseCallback(w *glfw.Window, x float64, y float64) {
 	camera.processMouseMovement(float32(xOffset), float32(yOffset), true)
 }
 
-func recreatePillar(N, M int) {
-	bubbles = createPillarOfBubbles(N, M, bubbleSpacing, uiSeed)
+// createBubbles starts a new world and creates the bubbles that show it. The world is either an NxMxK
+// pillar, stored a bool or a bit per cell, a pillar of continuous lenia cells, or an infinite
+// universe starting from the soup the pillar would have.
+func createBubbles(N, M, K int, seed int64) ([]*Bubble, error) {
+	size := life.Size{X: N, Y: M, Z: K}
+	w, err := newWorld(size, seed)
+	if err != nil {
+		return nil, err
+	}
+	world = w
+	return worldBubbles(world, size), nil
+}
+
+// worldBubbles creates the bubbles that show a world: one for every cell of the pillar, or one
+// for every live cell of the infinite universes.
+func worldBubbles(w life.World, size life.Size) []*Bubble {
+	if universe == universeInfinite || universe == universeHashLife {
+		return createSparseBubbles(w, bubbleSpacing)
+	}
+	return createPillarOfBubbles(w, size, bubbleSpacing)
+}
+
+// newWorld creates a world of the current universe, rule and lattice, filling a box of the given
+// size with the seeder's cells from the seed and placing the pattern, if there is one.
+func newWorld(size life.Size, seed int64) (life.World, error) {
+	if err := checkUniverse(universe, rule, lattice); err != nil {
+		return nil, err
+	}
+	var grid life.Bounded
+	switch universe {
+	case universeInfinite:
+		sparse, err := life.NewSparse(rule)
+		if err != nil {
+			return nil, err
+		}
+		sparse.SetLattice(lattice)
+		sparse.SetSeed(seed)
+		if err := seedWorld(sparse, size, seed); err != nil {
+			return nil, err
+		}
+		life.FillRandomSpecies(sparse, seed)
+		voxSpecies(sparse)
+		return sparse, nil
+	case universeHashLife:
+		hashLife, err := life.NewHashLife(rule)
+		if err != nil {
+			return nil, err
+		}
+		if err := seedWorld(hashLife, size, seed); err != nil {
+			return nil, err
+		}
+		return hashLife, nil
+	case universeLenia:
+		lenia, err := life.NewLenia(size, leniaParams)
+		if err != nil {
+			return nil, err
+		}
+		if seeder.Kind == life.RandomSeeder {
+			// Random soups start from random levels of life rather than fully alive cells
+			lenia.FillRandom(size, float32(seeder.Density), seed)
+		} else {
+			seeder.Fill(lenia, size, seed)
+		}
+		placeVox(lenia)
+		if err := placePattern(lenia, size); err != nil {
+			return nil, err
+		}
+		return lenia, nil
+	case universePacked:
+		bitGrid := life.NewBitGrid(size, rule, boundary)
+		bitGrid.SetLattice(lattice)
+		bitGrid.SetSeed(seed)
+		grid = bitGrid
+	default:
+		denseGrid := life.NewGrid(size, rule, boundary)
+		denseGrid.SetLattice(lattice)
+		denseGrid.SetSeed(seed)
+		grid = denseGrid
+	}
+
+	if err := seedWorld(grid, size, seed); err != nil {
+		return nil, err
+	}
+	life.FillRandomSpecies(grid.(life.Multispecies), seed)
+	voxSpecies(grid.(life.Multispecies))
+	return grid, nil
+}
+
+// checkUniverse reports rules and lattices that can't run in a universe.
+func checkUniverse(u string, r life.Rule, l life.Lattice) error {
+	switch u {
+	case universeInfinite:
+		return life.CheckUnboundedRule(r)
+	case universeHashLife:
+		if l != life.Cubic {
+			return fmt.Errorf("the hashlife universe only runs on the cubic lattice")
+		}
+		return life.CheckHashLifeRule(r)
+	case universeLenia:
+		if l != life.Cubic {
+			return fmt.Errorf("the lenia universe only runs on the cubic lattice")
+		}
+	}
+	return nil
+}
+
+// checkStagnation reports stagnation actions a universe can't carry out. Lenia doesn't run B/S
+// rules, so it has no rule to switch to.
+func checkStagnation(action, u string) error {
+	if action == stagnationRule && u == universeLenia {
+		return fmt.Errorf("the lenia universe can't switch rules when it settles")
+	}
+	return nil
+}
+
+// setLeniaParams changes the settings of the lenia universe. They are kept for later when another
+// universe is running.
+func setLeniaParams(p life.LeniaParams) error {
+	if lenia, ok := world.(*life.Lenia); ok {
+		if err := lenia.SetParams(p); err != nil {
+			return err
+		}
+		forgetPast()
+	} else if err := p.Check(); err != nil {
+		return err
+	}
+	leniaParams = p
+	return nil
+}
+
+// respondToStagnation carries out the stagnation action once the world has settled.
+func respondToStagnation() {
+	switch onStagnation {
+	case stagnationPause:
+		paused = true
+	case stagnationReseed:
+		uiSeed++
+		recreatePillar(uiN, uiM, uiK)
+	case stagnationRule:
+		// Skip presets the universe can't run
+		next := rule
+		for range rulePresets {
+			next = nextRulePreset(next, 1)
+			if checkUniverse(universe, next, lattice) == nil {
+				break
+			}
+		}
+		if err := setRule(next); err != nil {
+			ruleError = err.Error()
+		}
+	}
+}
+
+// showGeneration points the bubbles at the world's current generation, which they animate
+// towards, whether the world went forwards or backwards.
+func showGeneration() {
+	var added bool
+	if bubbles, added = syncBubbles(world, bubbles, bubbleSpacing); added {
+		initInstanceBuffer(bubbles)
+	}
+
+	// The goal is to find populations of bubbles and give them the same color. It's not great but
+	// results in a visually pleasing effect
+	numGroups := findGroups(bubbles, pillarN, pillarM, bubbleSpacing)
+	assignColorsToGroups(bubbles, numGroups)
+	updateColorBuffer(bubbles)
+}
+
+// rewind steps the world back n generations, or as far back as the history goes. It reports
+// whether the world changed.
+func rewind(n int) bool {
+	rewinder, ok := world.(life.Rewinder)
+	if !ok {
+		return false
+	}
+	snapshot, ok := history.Back(n)
+	if !ok {
+		ruleError = "no earlier generations kept"
+		return false
+	}
+	if err := rewinder.Restore(snapshot); err != nil {
+		ruleError = err.Error()
+		history.Clear()
+		return false
+	}
+	// The detector only follows generations going forwards
+	detector.Reset()
+	return true
+}
+
+// forgetPast drops what the detector and the history know of earlier generations, for when the
+// world is replaced or changed by hand.
+func forgetPast() {
+	detector.Reset()
+	history.Clear()
+}
+
+// setRule switches the running world to a new rule. When the rule brings in more species, the
+// live cells are shared out between them again.
+func setRule(r life.Rule) error {
+	if err := world.SetRule(r); err != nil {
+		return err
+	}
+	if multi, ok := world.(life.Multispecies); ok && r.Species > max(rule.Species, 1) {
+		life.FillRandomSpecies(multi, uiSeed)
+	}
+	rule = r
+	forgetPast()
+	return nil
+}
+
+// setBoundary changes what lies past the faces of the pillar. The infinite universe has no
+// faces, so it keeps the setting for when the pillar comes back.
+func setBoundary(b life.Boundary) {
+	boundary = b
+	if grid, ok := world.(life.Bounded); ok {
+		grid.SetBoundary(b)
+		forgetPast()
+	}
+}
+
+func recreatePillar(N, M, K int) {
+	newBubbles, err := createBubbles(N, M, K, uiSeed)
+	if err != nil {
+		ruleError = err.Error()
+		return
+	}
+	bubbles = newBubbles
+	forgetPast()
+	restartStats()
 	numGroups := findGroups(bubbles, N, M, bubbleSpacing)
 	assignColorsToGroups(bubbles, numGroups)
 	initInstanceBuffer(bubbles)
 	pillarM = M
 	pillarN = N
+	pillarK = K
 }
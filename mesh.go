@@ -0,0 +1,554 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/braheezy/bubblelife/life"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// Shapes live cells are exported as
+const (
+	// meshSpheres is a sphere per live bubble, the size and color it is drawn
+	meshSpheres = "spheres"
+	// meshCubes is a cube per live cell, merged into one solid without the faces between cells
+	meshCubes = "cubes"
+)
+
+// Mesh file formats
+const (
+	// meshOBJ is a Wavefront .obj file, with its colors in a .mtl file next to it
+	meshOBJ = "obj"
+	// meshPLY is a binary .ply file with a color per vertex
+	meshPLY = "ply"
+	// meshGLB is a binary glTF 2.0 .glb file. Spheres are instances of one sphere mesh per color
+	meshGLB = "glb"
+)
+
+var (
+	meshShapes  = []string{meshSpheres, meshCubes}
+	meshFormats = []string{meshOBJ, meshPLY, meshGLB}
+
+	// the format and shapes F4 exports the live cells in
+	meshFormat = meshGLB
+	meshShape  = meshSpheres
+)
+
+// how many slices around and stacks from pole to pole make up an exported sphere
+const (
+	sphereSlices = 16
+	sphereStacks = 10
+)
+
+// mesh is a triangle mesh with a normal and a color per vertex.
+type mesh struct {
+	positions, normals, colors []mgl32.Vec3
+	indices                    []uint32
+}
+
+// exportSphere is the sphere every exported bubble is a copy of.
+var exportSphere = unitSphere()
+
+// addSphere adds a sphere around a center.
+func (m *mesh) addSphere(center mgl32.Vec3, radius float32, color mgl32.Vec3) {
+	first := uint32(len(m.positions))
+	for _, normal := range exportSphere.normals {
+		m.positions = append(m.positions, center.Add(normal.Mul(radius)))
+		m.normals = append(m.normals, normal)
+		m.colors = append(m.colors, color)
+	}
+	for _, index := range exportSphere.indices {
+		m.indices = append(m.indices, first+index)
+	}
+}
+
+// addQuad adds a flat quad through four corners, given counterclockwise seen from the side the
+// normal points to.
+func (m *mesh) addQuad(corners [4]mgl32.Vec3, normal, color mgl32.Vec3) {
+	first := uint32(len(m.positions))
+	for _, corner := range corners {
+		m.positions = append(m.positions, corner)
+		m.normals = append(m.normals, normal)
+		m.colors = append(m.colors, color)
+	}
+	m.indices = append(m.indices, first, first+1, first+2, first, first+2, first+3)
+}
+
+// unitSphere returns a sphere of radius 1 around the origin, made of rings of latitude. Its
+// positions are also its normals, and its colors are left out.
+func unitSphere() mesh {
+	var m mesh
+	for stack := 0; stack <= sphereStacks; stack++ {
+		polar := math.Pi * float64(stack) / sphereStacks
+		for slice := 0; slice <= sphereSlices; slice++ {
+			azimuth := 2 * math.Pi * float64(slice) / sphereSlices
+			p := mgl32.Vec3{
+				float32(math.Sin(polar) * math.Cos(azimuth)),
+				float32(math.Cos(polar)),
+				float32(math.Sin(polar) * math.Sin(azimuth)),
+			}
+			m.positions = append(m.positions, p)
+			m.normals = append(m.normals, p)
+		}
+	}
+	ring := uint32(sphereSlices + 1)
+	for stack := uint32(0); stack < sphereStacks; stack++ {
+		for slice := uint32(0); slice < sphereSlices; slice++ {
+			a, b := stack*ring+slice, (stack+1)*ring+slice
+			// The triangles at the poles would have no area
+			if stack > 0 {
+				m.indices = append(m.indices, a, a+1, b)
+			}
+			if stack < sphereStacks-1 {
+				m.indices = append(m.indices, a+1, b+1, b)
+			}
+		}
+	}
+	return m
+}
+
+// liveBubbles returns the bubbles of live cells that can be seen.
+func liveBubbles(bubbles []*Bubble) []*Bubble {
+	var live []*Bubble
+	for _, bubble := range bubbles {
+		if bubble.CurrentState && bubble.Radius > 0 {
+			live = append(live, bubble)
+		}
+	}
+	return live
+}
+
+// cellBubbles returns bubbles for the live cells of a world that isn't shown, fully grown and
+// colored by species.
+func cellBubbles(w life.World, spacing float32) []*Bubble {
+	var live []*Bubble
+	for _, cell := range w.LiveCells() {
+		position := lattice.Position(cell)
+		bubble := NewBubble(mgl32.Vec3{float32(position[0]) * spacing, float32(position[1]) * spacing, float32(position[2]) * spacing})
+		bubble.Cell = cell
+		bubble.CurrentState = true
+		bubble.Radius = 1.0
+		if continuous, ok := w.(life.Continuous); ok {
+			bubble.Radius = float32(continuous.Value(cell))
+		}
+		if species, ok := w.(life.Multispecies); ok && rule.Species > 1 {
+			bubble.Color = speciesColor(species.Species(cell), rule.Species)
+		}
+		live = append(live, bubble)
+	}
+	return live
+}
+
+// sphereMesh merges a sphere for each bubble into one mesh.
+func sphereMesh(live []*Bubble) mesh {
+	var m mesh
+	for _, bubble := range live {
+		m.addSphere(bubble.Position, bubble.Radius, bubble.shownColor())
+	}
+	return m
+}
+
+// cubeFaces are the directions of the faces of a cube, with the corners of each face
+// counterclockwise from outside, for a cube from 0 to 1.
+var cubeFaces = []struct {
+	normal  life.Point
+	corners [4]mgl32.Vec3
+}{
+	{life.Point{X: 1}, [4]mgl32.Vec3{{1, 0, 0}, {1, 1, 0}, {1, 1, 1}, {1, 0, 1}}},
+	{life.Point{X: -1}, [4]mgl32.Vec3{{0, 0, 0}, {0, 0, 1}, {0, 1, 1}, {0, 1, 0}}},
+	{life.Point{Y: 1}, [4]mgl32.Vec3{{0, 1, 0}, {0, 1, 1}, {1, 1, 1}, {1, 1, 0}}},
+	{life.Point{Y: -1}, [4]mgl32.Vec3{{0, 0, 0}, {1, 0, 0}, {1, 0, 1}, {0, 0, 1}}},
+	{life.Point{Z: 1}, [4]mgl32.Vec3{{0, 0, 1}, {1, 0, 1}, {1, 1, 1}, {0, 1, 1}}},
+	{life.Point{Z: -1}, [4]mgl32.Vec3{{0, 0, 0}, {0, 1, 0}, {1, 1, 0}, {1, 0, 0}}},
+}
+
+// cubeMesh makes a cube the size of a cell for each bubble and leaves out the faces between
+// neighboring cubes, so they merge into solids. Only cells on the cubic lattice fill space with
+// cubes.
+func cubeMesh(live []*Bubble, spacing float32) (mesh, error) {
+	var m mesh
+	if lattice != life.Cubic {
+		return m, fmt.Errorf("cubes only fill space on the cubic lattice, export spheres on the %s lattice", lattice)
+	}
+	filled := make(map[life.Point]bool, len(live))
+	for _, bubble := range live {
+		filled[bubble.Cell] = true
+	}
+	for _, bubble := range live {
+		corner := bubble.Position.Sub(mgl32.Vec3{spacing / 2, spacing / 2, spacing / 2})
+		for _, face := range cubeFaces {
+			c := bubble.Cell
+			if filled[life.Point{X: c.X + face.normal.X, Y: c.Y + face.normal.Y, Z: c.Z + face.normal.Z}] {
+				continue
+			}
+			var corners [4]mgl32.Vec3
+			for i, offset := range face.corners {
+				corners[i] = corner.Add(offset.Mul(spacing))
+			}
+			normal := mgl32.Vec3{float32(face.normal.X), float32(face.normal.Y), float32(face.normal.Z)}
+			m.addQuad(corners, normal, bubble.shownColor())
+		}
+	}
+	return m, nil
+}
+
+// exportMesh writes the live bubbles shown to a file in the mesh format and shapes.
+func exportMesh() {
+	path := fmt.Sprintf("bubblelife-%s.%s", time.Now().Format("20060102-150405"), meshFormat)
+	live := liveBubbles(bubbles)
+	if err := writeMesh(path, meshFormat, meshShape, live, bubbleSpacing, world.Generation()); err != nil {
+		ruleError = fmt.Sprintf("couldn't export mesh: %v", err)
+		return
+	}
+	ruleError = fmt.Sprintf("wrote %d %s to %s", len(live), meshShape, path)
+}
+
+// writeMesh writes live bubbles as spheres or cubes to a file in a mesh format, noting the
+// generation they show where the format has room for comments.
+func writeMesh(path, format, shape string, live []*Bubble, spacing float32, generation int) error {
+	var m mesh
+	switch shape {
+	case meshSpheres:
+		// glTF files instance one sphere instead
+		if format != meshGLB {
+			m = sphereMesh(live)
+		}
+	case meshCubes:
+		var err error
+		if m, err = cubeMesh(live, spacing); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown mesh shape %q, want %s", shape, strings.Join(meshShapes, " or "))
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	out := bufio.NewWriter(file)
+	switch format {
+	case meshOBJ:
+		err = writeOBJ(out, m, path, generation)
+	case meshPLY:
+		err = writePLY(out, m, generation)
+	case meshGLB:
+		if shape == meshSpheres {
+			err = writeSpheresGLB(out, live)
+		} else {
+			err = writeMeshGLB(out, m)
+		}
+	default:
+		err = fmt.Errorf("unknown mesh format %q, want %s", format, strings.Join(meshFormats, ", "))
+	}
+	if err == nil {
+		err = out.Flush()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// writeOBJ writes a mesh as a Wavefront .obj file whose triangles are grouped by color, and the
+// materials of the colors to a .mtl file next to path.
+func writeOBJ(w io.Writer, m mesh, path string, generation int) error {
+	mtlPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".mtl"
+	fmt.Fprintf(w, "# bubblelife generation %d\nmtllib %s\n", generation, filepath.Base(mtlPath))
+	for _, p := range m.positions {
+		fmt.Fprintf(w, "v %g %g %g\n", p.X(), p.Y(), p.Z())
+	}
+	for _, n := range m.normals {
+		fmt.Fprintf(w, "vn %g %g %g\n", n.X(), n.Y(), n.Z())
+	}
+
+	// Triangles take the color of their first vertex, which all their vertices share
+	var colors []mgl32.Vec3
+	triangles := map[mgl32.Vec3][]uint32{}
+	for t := 0; t+2 < len(m.indices); t += 3 {
+		c := m.colors[m.indices[t]]
+		if _, ok := triangles[c]; !ok {
+			colors = append(colors, c)
+		}
+		triangles[c] = append(triangles[c], m.indices[t:t+3]...)
+	}
+	var mtl bytes.Buffer
+	for i, c := range colors {
+		fmt.Fprintf(&mtl, "newmtl color%d\nKd %g %g %g\n\n", i, c.X(), c.Y(), c.Z())
+		fmt.Fprintf(w, "usemtl color%d\n", i)
+		indices := triangles[c]
+		for t := 0; t < len(indices); t += 3 {
+			// OBJ counts vertices from 1
+			a, b, c := indices[t]+1, indices[t+1]+1, indices[t+2]+1
+			fmt.Fprintf(w, "f %d//%d %d//%d %d//%d\n", a, a, b, b, c, c)
+		}
+	}
+	return os.WriteFile(mtlPath, mtl.Bytes(), 0o644)
+}
+
+// writePLY writes a mesh as a binary .ply file with a color per vertex.
+func writePLY(w io.Writer, m mesh, generation int) error {
+	header := fmt.Sprintf("ply\nformat binary_little_endian 1.0\ncomment bubblelife generation %d\n"+
+		"element vertex %d\nproperty float x\nproperty float y\nproperty float z\n"+
+		"property float nx\nproperty float ny\nproperty float nz\n"+
+		"property uchar red\nproperty uchar green\nproperty uchar blue\n"+
+		"element face %d\nproperty list uchar uint vertex_indices\nend_header\n",
+		generation, len(m.positions), len(m.indices)/3)
+	if _, err := io.WriteString(w, header); err != nil {
+		return err
+	}
+	for i, p := range m.positions {
+		binary.Write(w, binary.LittleEndian, p)
+		binary.Write(w, binary.LittleEndian, m.normals[i])
+		c := m.colors[i]
+		w.Write([]byte{colorByte(c.X()), colorByte(c.Y()), colorByte(c.Z())})
+	}
+	for t := 0; t+2 < len(m.indices); t += 3 {
+		w.Write([]byte{3})
+		if err := binary.Write(w, binary.LittleEndian, m.indices[t:t+3]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// colorByte turns a color channel from 0 to 1 into a byte.
+func colorByte(c float32) byte {
+	return byte(min(max(c, 0), 1)*255.0 + 0.5)
+}
+
+// gltf is the JSON part of a glTF 2.0 file, with the parts the exports use.
+type gltf struct {
+	Asset struct {
+		Version   string `json:"version"`
+		Generator string `json:"generator"`
+	} `json:"asset"`
+	Scene       int              `json:"scene"`
+	Scenes      []gltfScene      `json:"scenes"`
+	Nodes       []gltfNode       `json:"nodes,omitempty"`
+	Meshes      []gltfMesh       `json:"meshes,omitempty"`
+	Materials   []gltfMaterial   `json:"materials,omitempty"`
+	Accessors   []gltfAccessor   `json:"accessors,omitempty"`
+	BufferViews []gltfBufferView `json:"bufferViews,omitempty"`
+	Buffers     []gltfBuffer     `json:"buffers,omitempty"`
+	// binary buffer the buffer views point into
+	bin bytes.Buffer
+}
+
+type gltfScene struct {
+	Nodes []int `json:"nodes"`
+}
+
+type gltfNode struct {
+	Mesh        *int        `json:"mesh,omitempty"`
+	Translation *[3]float32 `json:"translation,omitempty"`
+	Scale       *[3]float32 `json:"scale,omitempty"`
+}
+
+type gltfMesh struct {
+	Primitives []gltfPrimitive `json:"primitives"`
+}
+
+type gltfPrimitive struct {
+	Attributes map[string]int `json:"attributes"`
+	Indices    int            `json:"indices"`
+	Material   *int           `json:"material,omitempty"`
+}
+
+type gltfMaterial struct {
+	PBR struct {
+		BaseColorFactor [4]float32 `json:"baseColorFactor"`
+		MetallicFactor  float32    `json:"metallicFactor"`
+		RoughnessFactor float32    `json:"roughnessFactor"`
+	} `json:"pbrMetallicRoughness"`
+}
+
+type gltfAccessor struct {
+	BufferView    int       `json:"bufferView"`
+	ComponentType int       `json:"componentType"`
+	Count         int       `json:"count"`
+	Type          string    `json:"type"`
+	Min           []float32 `json:"min,omitempty"`
+	Max           []float32 `json:"max,omitempty"`
+}
+
+type gltfBufferView struct {
+	Buffer     int `json:"buffer"`
+	ByteOffset int `json:"byteOffset"`
+	ByteLength int `json:"byteLength"`
+	Target     int `json:"target"`
+}
+
+type gltfBuffer struct {
+	ByteLength int `json:"byteLength"`
+}
+
+// glTF constants for buffer targets and accessor component types
+const (
+	gltfArrayBuffer        = 34962
+	gltfElementArrayBuffer = 34963
+	gltfFloat              = 5126
+	gltfUnsignedInt        = 5125
+)
+
+// newGLTF starts a glTF document with one scene.
+func newGLTF() *gltf {
+	g := &gltf{Scenes: []gltfScene{{Nodes: []int{}}}}
+	g.Asset.Version = "2.0"
+	g.Asset.Generator = "bubblelife"
+	return g
+}
+
+// addVec3s adds an accessor for vectors, with the bounds positions need, and returns its index.
+func (g *gltf) addVec3s(vectors []mgl32.Vec3) int {
+	lo, hi := []float32{0, 0, 0}, []float32{0, 0, 0}
+	for i, v := range vectors {
+		for axis := 0; axis < 3; axis++ {
+			if i == 0 || v[axis] < lo[axis] {
+				lo[axis] = v[axis]
+			}
+			if i == 0 || v[axis] > hi[axis] {
+				hi[axis] = v[axis]
+			}
+		}
+	}
+	view := g.addBufferView(vectors, gltfArrayBuffer)
+	g.Accessors = append(g.Accessors, gltfAccessor{BufferView: view, ComponentType: gltfFloat, Count: len(vectors), Type: "VEC3", Min: lo, Max: hi})
+	return len(g.Accessors) - 1
+}
+
+// addIndices adds an accessor for triangle indices and returns its index.
+func (g *gltf) addIndices(indices []uint32) int {
+	view := g.addBufferView(indices, gltfElementArrayBuffer)
+	g.Accessors = append(g.Accessors, gltfAccessor{BufferView: view, ComponentType: gltfUnsignedInt, Count: len(indices), Type: "SCALAR"})
+	return len(g.Accessors) - 1
+}
+
+// addBufferView appends data to the binary buffer and returns the index of its view.
+func (g *gltf) addBufferView(data any, target int) int {
+	offset := g.bin.Len()
+	binary.Write(&g.bin, binary.LittleEndian, data)
+	g.BufferViews = append(g.BufferViews, gltfBufferView{ByteOffset: offset, ByteLength: g.bin.Len() - offset, Target: target})
+	return len(g.BufferViews) - 1
+}
+
+// addMaterial adds a material of a color and returns its index.
+func (g *gltf) addMaterial(c mgl32.Vec3) int {
+	var material gltfMaterial
+	// glTF colors are linear, while the bubbles' are sRGB
+	material.PBR.BaseColorFactor = [4]float32{linearColor(c.X()), linearColor(c.Y()), linearColor(c.Z()), 1}
+	material.PBR.RoughnessFactor = 0.3
+	g.Materials = append(g.Materials, material)
+	return len(g.Materials) - 1
+}
+
+// addNode adds a node to the scene and returns its index.
+func (g *gltf) addNode(node gltfNode) int {
+	g.Nodes = append(g.Nodes, node)
+	g.Scenes[0].Nodes = append(g.Scenes[0].Nodes, len(g.Nodes)-1)
+	return len(g.Nodes) - 1
+}
+
+// linearColor turns an sRGB color channel into a linear one.
+func linearColor(c float32) float32 {
+	if c <= 0.04045 {
+		return c / 12.92
+	}
+	return float32(math.Pow((float64(c)+0.055)/1.055, 2.4))
+}
+
+// writeSpheresGLB writes a glTF file with a sphere mesh for each color, and a node per bubble
+// that places an instance of the sphere of its color.
+func writeSpheresGLB(w io.Writer, live []*Bubble) error {
+	g := newGLTF()
+	if len(live) > 0 {
+		positions := g.addVec3s(exportSphere.positions)
+		normals := g.addVec3s(exportSphere.normals)
+		indices := g.addIndices(exportSphere.indices)
+		meshes := map[mgl32.Vec3]int{}
+		for _, bubble := range live {
+			c := bubble.shownColor()
+			index, ok := meshes[c]
+			if !ok {
+				material := g.addMaterial(c)
+				g.Meshes = append(g.Meshes, gltfMesh{Primitives: []gltfPrimitive{{
+					Attributes: map[string]int{"POSITION": positions, "NORMAL": normals},
+					Indices:    indices,
+					Material:   &material,
+				}}})
+				index = len(g.Meshes) - 1
+				meshes[c] = index
+			}
+			p, r := bubble.Position, bubble.Radius
+			g.addNode(gltfNode{Mesh: &index, Translation: &[3]float32{p.X(), p.Y(), p.Z()}, Scale: &[3]float32{r, r, r}})
+		}
+	}
+	return g.writeGLB(w)
+}
+
+// writeMeshGLB writes a glTF file of one mesh with a color per vertex.
+func writeMeshGLB(w io.Writer, m mesh) error {
+	g := newGLTF()
+	if len(m.indices) > 0 {
+		linear := make([]mgl32.Vec3, len(m.colors))
+		for i, c := range m.colors {
+			linear[i] = mgl32.Vec3{linearColor(c.X()), linearColor(c.Y()), linearColor(c.Z())}
+		}
+		attributes := map[string]int{
+			"POSITION": g.addVec3s(m.positions),
+			"NORMAL":   g.addVec3s(m.normals),
+			"COLOR_0":  g.addVec3s(linear),
+		}
+		material := g.addMaterial(mgl32.Vec3{1, 1, 1})
+		g.Meshes = append(g.Meshes, gltfMesh{Primitives: []gltfPrimitive{{Attributes: attributes, Indices: g.addIndices(m.indices), Material: &material}}})
+		mesh := 0
+		g.addNode(gltfNode{Mesh: &mesh})
+	}
+	return g.writeGLB(w)
+}
+
+// writeGLB writes the document as a binary glTF file: a header, then the JSON and the binary
+// buffer, each padded to 4 bytes.
+func (g *gltf) writeGLB(w io.Writer) error {
+	for g.bin.Len()%4 != 0 {
+		g.bin.WriteByte(0)
+	}
+	if g.bin.Len() > 0 {
+		g.Buffers = []gltfBuffer{{ByteLength: g.bin.Len()}}
+	}
+	document, err := json.Marshal(g)
+	if err != nil {
+		return err
+	}
+	for len(document)%4 != 0 {
+		document = append(document, ' ')
+	}
+	length := 12 + 8 + len(document)
+	if g.bin.Len() > 0 {
+		length += 8 + g.bin.Len()
+	}
+
+	var out bytes.Buffer
+	out.WriteString("glTF")
+	binary.Write(&out, binary.LittleEndian, []uint32{2, uint32(length)})
+	binary.Write(&out, binary.LittleEndian, uint32(len(document)))
+	out.WriteString("JSON")
+	out.Write(document)
+	if g.bin.Len() > 0 {
+		binary.Write(&out, binary.LittleEndian, uint32(g.bin.Len()))
+		out.WriteString("BIN\x00")
+		out.Write(g.bin.Bytes())
+	}
+	_, err = w.Write(out.Bytes())
+	return err
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/braheezy/bubblelife/life"
+)
+
+var (
+	// the pattern placed in new worlds, if any, and the cell its corner goes at. Patterns without
+	// a place go in the middle of the pillar.
+	pattern   *life.Pattern
+	patternAt *life.Point
+)
+
+// loadPattern reads a pattern from a file, or from the library when there's no such file.
+func loadPattern(nameOrPath string) (life.Pattern, error) {
+	file, err := os.Open(nameOrPath)
+	if err != nil {
+		if os.IsNotExist(err) && !strings.ContainsAny(nameOrPath, `/\.`) {
+			return life.LibraryPattern(nameOrPath)
+		}
+		return life.Pattern{}, err
+	}
+	defer file.Close()
+	p, err := life.ParsePattern(file)
+	if err != nil {
+		return p, fmt.Errorf("%s: %w", nameOrPath, err)
+	}
+	return p, nil
+}
+
+// parsePatternAt parses the cell a pattern's corner is placed at, like "2,8,2". An empty place
+// means the middle of the pillar.
+func parsePatternAt(s string) (*life.Point, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	parts := strings.Split(s, ",")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("pattern place must be three cell coordinates like 2,8,2, got %q", s)
+	}
+	var coordinates [3]int
+	for i, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil {
+			return nil, fmt.Errorf("pattern place must be three cell coordinates like 2,8,2, got %q", s)
+		}
+		coordinates[i] = n
+	}
+	return &life.Point{X: coordinates[0], Y: coordinates[1], Z: coordinates[2]}, nil
+}
+
+// seedWorld fills a box of the given size with the seeder's cells and places the MagicaVoxel
+// model and the pattern over them.
+func seedWorld(w life.World, size life.Size, seed int64) error {
+	seeder.Fill(w, size, seed)
+	placeVox(w)
+	return placePattern(w, size)
+}
+
+// placePattern places the pattern, if there is one, in a box of the given size. It has to fit
+// inside the box.
+func placePattern(w life.World, size life.Size) error {
+	if pattern == nil {
+		return nil
+	}
+	p := pattern.Size
+	at := life.Point{X: (size.X - p.X) / 2, Y: (size.Y - p.Y) / 2, Z: (size.Z - p.Z) / 2}
+	if patternAt != nil {
+		at = *patternAt
+	}
+	if at.X < 0 || at.Y < 0 || at.Z < 0 || at.X+p.X > size.X || at.Y+p.Y > size.Y || at.Z+p.Z > size.Z {
+		return fmt.Errorf("the %dx%dx%d pattern doesn't fit in the %dx%dx%d pillar at %d,%d,%d",
+			p.X, p.Y, p.Z, size.X, size.Y, size.Z, at.X, at.Y, at.Z)
+	}
+	pattern.Place(w, at)
+	return nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/braheezy/bubblelife/life"
+)
+
+// most generations of stats kept in memory. Older ones are dropped, though they stay in the
+// stats file when recording continuously.
+const maxRecordedStats = 100000
+
+var (
+	// stats of the generations shown since the pillar was created, oldest first
+	recorded []life.Stats
+	census   = life.NewCensus()
+
+	// format stats are exported in, and the file every generation is written to as it's shown
+	// when recording continuously
+	statsFormat = life.StatsCSV
+	statsPath   string
+	statsFile   *os.File
+	statsBuffer *bufio.Writer
+	statsStream *life.StatsWriter
+)
+
+// openStatsFile starts recording the stats of every generation shown to the stats file.
+func openStatsFile() error {
+	file, err := os.Create(statsPath)
+	if err != nil {
+		return err
+	}
+	statsBuffer = bufio.NewWriter(file)
+	if statsStream, err = life.NewStatsWriter(statsBuffer, statsFormat); err != nil {
+		file.Close()
+		return err
+	}
+	statsFile = file
+	return nil
+}
+
+// closeStatsFile writes out what is left of the stats file.
+func closeStatsFile() error {
+	if statsFile == nil {
+		return nil
+	}
+	err := statsStream.Flush()
+	if err == nil {
+		err = statsBuffer.Flush()
+	}
+	if closeErr := statsFile.Close(); err == nil {
+		err = closeErr
+	}
+	statsFile, statsStream = nil, nil
+	return err
+}
+
+// restartStats starts the record over with the first generation of a new pillar.
+func restartStats() {
+	recorded = recorded[:0]
+	census.Reset()
+	recordStats()
+}
+
+// recordStats records the stats of the generation the world is at. When the world went back,
+// the record is cut back to match, so it always follows the generations that led to the current
+// one.
+func recordStats() {
+	generation := world.Generation()
+	n := len(recorded)
+	for n > 0 && recorded[n-1].Generation >= generation {
+		n--
+	}
+	if n < len(recorded) {
+		recorded = recorded[:n]
+		// Births and deaths would be counted against a later generation
+		census.Reset()
+	}
+	if len(recorded) >= 2*maxRecordedStats {
+		recorded = append(recorded[:0], recorded[len(recorded)-maxRecordedStats:]...)
+	}
+	stats := census.Count(world)
+	recorded = append(recorded, stats)
+
+	if statsStream != nil {
+		err := statsStream.Write(stats)
+		if err == nil {
+			err = statsStream.Flush()
+		}
+		if err == nil {
+			err = statsBuffer.Flush()
+		}
+		if err != nil {
+			ruleError = fmt.Sprintf("stopped recording stats: %v", err)
+			closeStatsFile()
+		}
+	}
+}
+
+// exportStats writes the stats recorded so far to a new file in the current directory, named
+// after the time.
+func exportStats() {
+	path := fmt.Sprintf("bubblelife-stats-%s.%s", time.Now().Format("20060102-150405"), statsFormat)
+	if err := writeStats(path, recorded); err != nil {
+		ruleError = fmt.Sprintf("couldn't export stats: %v", err)
+		return
+	}
+	ruleError = fmt.Sprintf("wrote %d generations of stats to %s", len(recorded), path)
+}
+
+// writeStats writes stats to a file in the stats format.
+func writeStats(path string, stats []life.Stats) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	buffered := bufio.NewWriter(file)
+	writer, err := life.NewStatsWriter(buffered, statsFormat)
+	if err != nil {
+		return err
+	}
+	for _, s := range stats {
+		if err := writer.Write(s); err != nil {
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+	"slices"
+
+	"github.com/braheezy/bubblelife/life"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// A session file holds what it takes to bring a run back as it was: the scene settings, the cells
+// of the generation shown, the colors of their bubbles and the camera. It starts with "BLSN" and
+// the version of the format, then come sections, and a CRC-32 of everything before it ends the
+// file. Numbers are little endian. Each section is a four letter id, the length of its content as
+// a uint32, and the content:
+//
+//	SETS  the settings as JSON, like a config file, and whether the run was paused
+//	CELL  the generation as a uvarint, then the deflated cells of a life.Snapshot
+//	COLR  deflated: the number of colored cells as a uvarint, then for each its coordinates as
+//	      varints and its color as three float32s
+//	CAMR  the camera's position, yaw, pitch and zoom as float32s
+//
+// Readers skip sections they don't know, so sections can be added without a new version. The
+// version only goes up when a section changes in a way older releases would misread, and every
+// release reads the versions before its own.
+const (
+	sessionMagic   = "BLSN"
+	sessionVersion = 1
+)
+
+// where F5 saves the session and F9 loads it from, the file given to -load if there was one
+var sessionPath = "bubblelife.session"
+
+// the session -load brings back once the window is open
+var startSession *session
+
+// session is a run saved to or loaded from a session file.
+type session struct {
+	settings sessionSettings
+	cells    life.Snapshot
+	// colors of the bubbles of live cells, which are picked at random for each group
+	colors map[life.Point]mgl32.Vec3
+	// camera is nil if the file has none
+	camera *cameraPose
+}
+
+// sessionSettings are the settings of a session, kept as JSON so settings can come and go
+// between releases.
+type sessionSettings struct {
+	Config
+	Paused bool `json:"paused,omitempty"`
+}
+
+// cameraPose is where the camera is and where it looks.
+type cameraPose struct {
+	position         mgl32.Vec3
+	yaw, pitch, zoom float32
+}
+
+// takeSession saves the run as it is now.
+func takeSession() (session, error) {
+	rewinder, ok := world.(life.Rewinder)
+	if !ok {
+		return session{}, errors.New("the world can't be saved")
+	}
+	s := session{
+		settings: sessionSettings{Config: currentConfig(), Paused: paused},
+		cells:    rewinder.Snapshot(),
+		colors:   make(map[life.Point]mgl32.Vec3),
+		camera:   &cameraPose{position: camera.position, yaw: camera.yaw, pitch: camera.pitch, zoom: camera.zoom},
+	}
+	for _, bubble := range bubbles {
+		// Bubbles of dead cells still shrinking away aren't brought back
+		if bubble.NextState {
+			s.colors[bubble.Cell] = bubble.Color
+		}
+	}
+	return s, nil
+}
+
+// saveSession writes the run to the session file.
+func saveSession() {
+	s, err := takeSession()
+	if err == nil {
+		err = writeSessionFile(sessionPath, s)
+	}
+	if err != nil {
+		ruleError = fmt.Sprintf("couldn't save session: %v", err)
+		return
+	}
+	ruleError = fmt.Sprintf("saved generation %d to %s", s.cells.Generation, sessionPath)
+}
+
+// loadSession brings back the run in the session file.
+func loadSession() {
+	s, err := readSessionFile(sessionPath)
+	if err == nil {
+		err = restoreSession(s)
+	}
+	if err != nil {
+		ruleError = fmt.Sprintf("couldn't load session: %v", err)
+		return
+	}
+	ruleError = fmt.Sprintf("loaded generation %d from %s", s.cells.Generation, sessionPath)
+}
+
+// restoreSession replaces the scene with a saved one: its settings, world, bubbles and camera.
+func restoreSession(s session) error {
+	if err := applyConfig(s.settings.Config); err != nil {
+		return err
+	}
+	size := life.Size{X: pillarN, Y: pillarM, Z: pillarK}
+	w, err := newWorld(size, uiSeed)
+	if err != nil {
+		return err
+	}
+	rewinder, ok := w.(life.Rewinder)
+	if !ok {
+		return fmt.Errorf("the %s universe can't be loaded", universe)
+	}
+	if err := rewinder.Restore(s.cells); err != nil {
+		// The settings are in place by now, so the pillar starts over from them instead
+		recreatePillar(pillarN, pillarM, pillarK)
+		return fmt.Errorf("started the pillar over, the cells don't fit: %w", err)
+	}
+
+	world = w
+	paused = s.settings.Paused
+	bubbles = worldBubbles(world, size)
+	// Bubbles of dying cells start out as far shrunk and faded as they were
+	bubbles, _ = syncBubbles(world, bubbles, bubbleSpacing)
+	for _, bubble := range bubbles {
+		bubble.Radius = bubble.targetRadius()
+		bubble.CurrentState = bubble.NextState
+		if color, ok := s.colors[bubble.Cell]; ok && bubble.NextState {
+			bubble.Color = color
+		}
+	}
+	forgetPast()
+	restartStats()
+	initInstanceBuffer(bubbles)
+
+	if s.camera != nil && camera != nil {
+		camera.position = s.camera.position
+		camera.yaw, camera.pitch, camera.zoom = s.camera.yaw, s.camera.pitch, s.camera.zoom
+		camera.updateVectors()
+	}
+	return nil
+}
+
+// readSessionFile reads a session from a file.
+func readSessionFile(path string) (session, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return session{}, err
+	}
+	defer file.Close()
+	s, err := readSession(file)
+	if err != nil {
+		return s, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// writeSessionFile writes a session to a file.
+func writeSessionFile(path string, s session) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeSession(file, s); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// writeSession writes a session in the session format.
+func writeSession(w io.Writer, s session) error {
+	settings, err := json.Marshal(s.settings)
+	if err != nil {
+		return err
+	}
+	cells := binary.AppendUvarint(nil, uint64(s.cells.Generation))
+	cells = append(cells, s.cells.Cells...)
+
+	// Cells are written in order so the same session always makes the same file
+	points := make([]life.Point, 0, len(s.colors))
+	for p := range s.colors {
+		points = append(points, p)
+	}
+	slices.SortFunc(points, func(a, b life.Point) int {
+		return cmp.Or(cmp.Compare(a.X, b.X), cmp.Compare(a.Y, b.Y), cmp.Compare(a.Z, b.Z))
+	})
+	colors := binary.AppendUvarint(nil, uint64(len(points)))
+	for _, p := range points {
+		colors = binary.AppendVarint(colors, int64(p.X))
+		colors = binary.AppendVarint(colors, int64(p.Y))
+		colors = binary.AppendVarint(colors, int64(p.Z))
+		c := s.colors[p]
+		colors = appendFloats(colors, c[:]...)
+	}
+	var deflated bytes.Buffer
+	compressor, _ := flate.NewWriter(&deflated, flate.BestCompression)
+	compressor.Write(colors)
+	compressor.Close()
+
+	var file bytes.Buffer
+	file.WriteString(sessionMagic)
+	binary.Write(&file, binary.LittleEndian, uint16(sessionVersion))
+	writeSessionSection(&file, "SETS", settings)
+	writeSessionSection(&file, "CELL", cells)
+	writeSessionSection(&file, "COLR", deflated.Bytes())
+	if c := s.camera; c != nil {
+		writeSessionSection(&file, "CAMR", appendFloats(nil, c.position.X(), c.position.Y(), c.position.Z(), c.yaw, c.pitch, c.zoom))
+	}
+	binary.Write(&file, binary.LittleEndian, crc32.ChecksumIEEE(file.Bytes()))
+	_, err = w.Write(file.Bytes())
+	return err
+}
+
+// writeSessionSection writes a section with its content.
+func writeSessionSection(b *bytes.Buffer, id string, content []byte) {
+	b.WriteString(id)
+	binary.Write(b, binary.LittleEndian, uint32(len(content)))
+	b.Write(content)
+}
+
+// appendFloats writes float32s in little endian order.
+func appendFloats(b []byte, values ...float32) []byte {
+	for _, v := range values {
+		b = binary.LittleEndian.AppendUint32(b, math.Float32bits(v))
+	}
+	return b
+}
+
+// readFloats reads float32s written by appendFloats into values, returning what follows them.
+func readFloats(b []byte, values ...*float32) ([]byte, error) {
+	if len(b) < 4*len(values) {
+		return nil, errors.New("session: section is cut short")
+	}
+	for i, v := range values {
+		*v = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+	}
+	return b[4*len(values):], nil
+}
+
+// readSession reads a session in the session format, checking it isn't damaged.
+func readSession(r io.Reader) (session, error) {
+	var s session
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return s, err
+	}
+	if len(data) < len(sessionMagic)+2+4 || string(data[:len(sessionMagic)]) != sessionMagic {
+		return s, errors.New("session: not a bubblelife session file")
+	}
+	body, sum := data[:len(data)-4], binary.LittleEndian.Uint32(data[len(data)-4:])
+	if crc32.ChecksumIEEE(body) != sum {
+		return s, errors.New("session: file is damaged, its checksum doesn't match")
+	}
+	version := binary.LittleEndian.Uint16(body[len(sessionMagic):])
+	if version < 1 || version > sessionVersion {
+		return s, fmt.Errorf("session: file is version %d, this release reads up to version %d", version, sessionVersion)
+	}
+
+	var hasSettings, hasCells bool
+	for rest := body[len(sessionMagic)+2:]; len(rest) > 0; {
+		if len(rest) < 8 {
+			return s, errors.New("session: file ends in the middle of a section header")
+		}
+		id, length := string(rest[:4]), binary.LittleEndian.Uint32(rest[4:])
+		rest = rest[8:]
+		if uint64(length) > uint64(len(rest)) {
+			return s, fmt.Errorf("session: %q section is longer than the file", id)
+		}
+		content := rest[:length]
+		rest = rest[length:]
+		switch id {
+		case "SETS":
+			if err := json.Unmarshal(content, &s.settings); err != nil {
+				return s, fmt.Errorf("session: settings: %w", err)
+			}
+			hasSettings = true
+		case "CELL":
+			generation, n := binary.Uvarint(content)
+			if n <= 0 || generation > math.MaxInt {
+				return s, errors.New("session: cells section has no generation")
+			}
+			s.cells = life.Snapshot{Generation: int(generation), Cells: content[n:]}
+			hasCells = true
+		case "COLR":
+			if s.colors, err = readSessionColors(content); err != nil {
+				return s, err
+			}
+		case "CAMR":
+			var c cameraPose
+			if _, err := readFloats(content, &c.position[0], &c.position[1], &c.position[2], &c.yaw, &c.pitch, &c.zoom); err != nil {
+				return s, err
+			}
+			s.camera = &c
+		}
+		// Sections of later releases are skipped
+	}
+	if !hasSettings || !hasCells {
+		return s, errors.New("session: file needs both settings and cells")
+	}
+	return s, nil
+}
+
+// readSessionColors reads the content of a COLR section.
+func readSessionColors(content []byte) (map[life.Point]mgl32.Vec3, error) {
+	cut := errors.New("session: colors section is cut short")
+	data, err := io.ReadAll(flate.NewReader(bytes.NewReader(content)))
+	if err != nil {
+		return nil, fmt.Errorf("session: colors: %w", err)
+	}
+	count, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, cut
+	}
+	data = data[n:]
+	// Every cell takes at least 15 bytes, which keeps a bad count from asking for too much memory
+	colors := make(map[life.Point]mgl32.Vec3, min(count, uint64(len(data)/15)))
+	for i := uint64(0); i < count; i++ {
+		var coordinates [3]int64
+		for axis := range coordinates {
+			if coordinates[axis], n = binary.Varint(data); n <= 0 {
+				return nil, cut
+			}
+			data = data[n:]
+		}
+		var c mgl32.Vec3
+		if data, err = readFloats(data, &c[0], &c[1], &c[2]); err != nil {
+			return nil, cut
+		}
+		colors[life.Point{X: int(coordinates[0]), Y: int(coordinates[1]), Z: int(coordinates[2])}] = c
+	}
+	return colors, nil
+}
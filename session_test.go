@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/braheezy/bubblelife/life"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// goldenSession is the session kept in testdata/session-v1.session, which was written by the
+// first release of the format. Every later release must still read it.
+func goldenSession(t *testing.T) (session, *life.Grid) {
+	t.Helper()
+	glider, err := life.LibraryPattern("bays-glider")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grid := life.NewGrid(life.Size{X: 6, Y: 7, Z: 5}, life.MustParseRule("4555"), life.Torus)
+	glider.Place(grid, life.Point{X: 1, Y: 1, Z: 1})
+	for i := 0; i < 3; i++ {
+		grid.Step()
+	}
+	s := session{
+		settings: sessionSettings{
+			Config: Config{Rule: "4555", Boundary: "periodic", Seed: 7, Width: 6, Height: 7, Depth: 5, GenerationSpeed: 0.25},
+			Paused: true,
+		},
+		cells:  grid.Snapshot(),
+		colors: make(map[life.Point]mgl32.Vec3),
+		camera: &cameraPose{position: mgl32.Vec3{3, 12.5, -20}, yaw: 90, pitch: -15.5, zoom: 45},
+	}
+	for i, p := range grid.LiveCells() {
+		s.colors[p] = mgl32.Vec3{float32(i) / 10, 0.5, 1 - float32(i)/20}
+	}
+	return s, grid
+}
+
+// sameSession reports whether two sessions hold the same run.
+func sameSession(a, b session) bool {
+	if a.settings != b.settings || a.cells.Generation != b.cells.Generation || !bytes.Equal(a.cells.Cells, b.cells.Cells) {
+		return false
+	}
+	if !maps.Equal(a.colors, b.colors) || (a.camera == nil) != (b.camera == nil) {
+		return false
+	}
+	return a.camera == nil || *a.camera == *b.camera
+}
+
+// sealSession puts a fresh checksum on a session file whose last four bytes are its checksum.
+func sealSession(data []byte) []byte {
+	body := slices.Clone(data[:len(data)-4])
+	return binary.LittleEndian.AppendUint32(body, crc32.ChecksumIEEE(body))
+}
+
+// sessionWithSections writes a session file of the given version holding the sections, each
+// given as its id and content.
+func sessionWithSections(version uint16, sections ...string) []byte {
+	var file bytes.Buffer
+	file.WriteString(sessionMagic)
+	binary.Write(&file, binary.LittleEndian, version)
+	for _, section := range sections {
+		writeSessionSection(&file, section[:4], []byte(section[4:]))
+	}
+	return binary.LittleEndian.AppendUint32(file.Bytes(), crc32.ChecksumIEEE(file.Bytes()))
+}
+
+func TestSessionRoundTrip(t *testing.T) {
+	s, _ := goldenSession(t)
+	withoutCamera := s
+	withoutCamera.camera = nil
+	for _, want := range []session{s, withoutCamera} {
+		var file bytes.Buffer
+		if err := writeSession(&file, want); err != nil {
+			t.Fatal(err)
+		}
+		got, err := readSession(&file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameSession(got, want) {
+			t.Errorf("session read back as %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestSessionGolden(t *testing.T) {
+	s, grid := goldenSession(t)
+	got, err := readSessionFile("testdata/session-v1.session")
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := life.NewGrid(grid.Size(), grid.Rule(), grid.Boundary())
+	if err := restored.Restore(got.cells); err != nil {
+		t.Fatal(err)
+	}
+	if restored.Generation() != 3 || !slices.Equal(restored.LiveCells(), grid.LiveCells()) {
+		t.Errorf("golden cells restored to generation %d with %d live cells, want generation 3 with %d",
+			restored.Generation(), len(restored.LiveCells()), len(grid.LiveCells()))
+	}
+	// The deflated cells needn't match what this release writes byte for byte, only restore the same
+	got.cells.Cells = s.cells.Cells
+	if !sameSession(got, s) {
+		t.Errorf("golden session read as %+v, want %+v", got, s)
+	}
+}
+
+func TestSessionUnknownSection(t *testing.T) {
+	s, _ := goldenSession(t)
+	var file bytes.Buffer
+	if err := writeSession(&file, s); err != nil {
+		t.Fatal(err)
+	}
+	// A later release might add a section after the ones this release writes
+	data := file.Bytes()
+	var body bytes.Buffer
+	body.Write(data[:len(data)-4])
+	writeSessionSection(&body, "XTRA", []byte("whatever comes next"))
+	body.Write(make([]byte, 4))
+	got, err := readSession(bytes.NewReader(sealSession(body.Bytes())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameSession(got, s) {
+		t.Errorf("session with an unknown section read as %+v, want %+v", got, s)
+	}
+}
+
+func TestSessionRejected(t *testing.T) {
+	s, _ := goldenSession(t)
+	var file bytes.Buffer
+	if err := writeSession(&file, s); err != nil {
+		t.Fatal(err)
+	}
+	valid := file.Bytes()
+	badMagic := slices.Clone(valid)
+	copy(badMagic, "BLSX")
+	badChecksum := slices.Clone(valid)
+	badChecksum[len(badChecksum)/2] ^= 1
+	futureVersion := slices.Clone(valid)
+	binary.LittleEndian.PutUint16(futureVersion[len(sessionMagic):], sessionVersion+1)
+	// The camera's section comes last, so cutting into it leaves it longer than what's left
+	truncatedSection := append(slices.Clone(valid[:len(valid)-4-10]), 0, 0, 0, 0)
+	truncatedHeader := append(slices.Clone(valid[:len(valid)-4-24-5]), 0, 0, 0, 0)
+
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"empty", nil, "session: not a bubblelife session file"},
+		{"bad magic", badMagic, "session: not a bubblelife session file"},
+		{"bad checksum", badChecksum, "session: file is damaged, its checksum doesn't match"},
+		{"future version", sealSession(futureVersion), "session: file is version 2, this release reads up to version 1"},
+		{"version 0", sessionWithSections(0), "session: file is version 0, this release reads up to version 1"},
+		{"truncated section", sealSession(truncatedSection), `session: "CAMR" section is longer than the file`},
+		{"truncated section header", sealSession(truncatedHeader), "session: file ends in the middle of a section header"},
+		{"no settings", sessionWithSections(1, "CELL\x00"), "session: file needs both settings and cells"},
+		{"no cells", sessionWithSections(1, "SETS{}"), "session: file needs both settings and cells"},
+		{"nothing", sessionWithSections(1), "session: file needs both settings and cells"},
+	}
+	for _, test := range tests {
+		_, err := readSession(bytes.NewReader(test.data))
+		if err == nil || err.Error() != test.want {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestSessionFileError(t *testing.T) {
+	path := t.TempDir() + "/damaged.session"
+	if err := os.WriteFile(path, []byte("BLSN"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Errors reading a file name it, so the message on screen says which file was bad
+	if _, err := readSessionFile(path); err == nil || !strings.HasPrefix(err.Error(), path+": ") {
+		t.Errorf("got error %v, want one naming %s", err, path)
+	}
+}
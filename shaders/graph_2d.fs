@@ -0,0 +1,10 @@
+#version 410 core
+out vec4 color;
+
+uniform vec3 lineColor;
+uniform float alpha;
+
+void main()
+{
+    color = vec4(lineColor, alpha);
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/braheezy/bubblelife/life"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// simTable is the sim format that lines the main stats up in columns for people to read.
+const simTable = "table"
+
+// statsWriter writes the stats of generations one after another.
+type statsWriter interface {
+	Write(stats life.Stats) error
+	Flush() error
+}
+
+// tableWriter writes the main stats of each generation as a row of a table, under a header.
+type tableWriter struct {
+	out     io.Writer
+	started bool
+}
+
+func (t *tableWriter) Write(stats life.Stats) error {
+	if !t.started {
+		t.started = true
+		if _, err := fmt.Fprintf(t.out, "%10s %10s %10s %10s %10s %10s\n", "generation", "population", "births", "deaths", "groups", "largest"); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(t.out, "%10d %10d %10d %10d %10d %10d\n",
+		stats.Generation, stats.Population, stats.Births, stats.Deaths, stats.Groups, stats.LargestGroup)
+	return err
+}
+
+func (t *tableWriter) Flush() error {
+	return nil
+}
+
+// runSim runs the simulation without a window for `bubblelife sim`, writing the stats of every
+// generation as a table, CSV or JSON Lines. It takes the same settings as the window, along with
+// how many generations to run and where to write the stats, which is out unless a file is given.
+func runSim(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("bubblelife sim", flag.ContinueOnError)
+	readConfig := settingsFlags(flags)
+	generations := flags.Int("generations", 100, "number of generations to run")
+	outPath := flags.String("out", "", "file to write the stats to instead of standard output")
+	format := flags.String("format", simTable, "how to write the stats: table, csv or jsonl (every stat, one JSON object per line)")
+	voxPath := flags.String("vox-out", "", "MagicaVoxel .vox file to write the live cells of the last generation to")
+	meshPath := flags.String("mesh-out", "", "mesh file to write the live cells of the last generation to, in the format of its extension: .obj, .ply or .glb")
+	shape := flags.String("mesh-shape", meshSpheres, "shapes the mesh shows the live cells as: spheres or cubes")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments %q", flags.Args())
+	}
+	config, err := readConfig()
+	if err != nil {
+		return err
+	}
+	if err := applyConfig(config); err != nil {
+		return err
+	}
+	if *generations < 0 {
+		return fmt.Errorf("generations can't be negative, got %d", *generations)
+	}
+
+	if *format != simTable && *format != life.StatsCSV && *format != life.StatsJSONL {
+		return fmt.Errorf("unknown format %q, want %s, %s or %s", *format, simTable, life.StatsCSV, life.StatsJSONL)
+	}
+
+	meshExt := strings.TrimPrefix(filepath.Ext(*meshPath), ".")
+	if *meshPath != "" && !slices.Contains(meshFormats, meshExt) {
+		return fmt.Errorf("mesh file %s must end in .obj, .ply or .glb", *meshPath)
+	}
+	if !slices.Contains(meshShapes, *shape) {
+		return fmt.Errorf("unknown mesh shape %q, want %s", *shape, strings.Join(meshShapes, " or "))
+	}
+
+	w, err := newWorld(life.Size{X: pillarN, Y: pillarM, Z: pillarK}, initialSeed)
+	if err != nil {
+		return err
+	}
+
+	var file *os.File
+	if *outPath != "" {
+		if file, err = os.Create(*outPath); err != nil {
+			return err
+		}
+		defer file.Close()
+		out = file
+	}
+	buffered := bufio.NewWriter(out)
+	var stats statsWriter = &tableWriter{out: buffered}
+	if *format != simTable {
+		if stats, err = life.NewStatsWriter(buffered, *format); err != nil {
+			return err
+		}
+	}
+
+	census := life.NewCensus()
+	for {
+		if err := stats.Write(census.Count(w)); err != nil {
+			return err
+		}
+		if w.Generation() >= *generations {
+			break
+		}
+		w.Step()
+	}
+	if err := stats.Flush(); err != nil {
+		return err
+	}
+	if err := buffered.Flush(); err != nil {
+		return err
+	}
+	if *voxPath != "" {
+		// There are no bubbles to take colors from, so only species are told apart
+		v := worldVox(w, func(p life.Point) mgl32.Vec3 {
+			if species, ok := w.(life.Multispecies); ok && rule.Species > 1 {
+				return speciesColor(species.Species(p), rule.Species)
+			}
+			return textColor
+		})
+		if err := writeVox(*voxPath, v); err != nil {
+			return err
+		}
+	}
+	if *meshPath != "" {
+		if err := writeMesh(*meshPath, meshExt, *shape, cellBubbles(w, bubbleSpacing), bubbleSpacing, w.Generation()); err != nil {
+			return err
+		}
+	}
+	if file != nil {
+		return file.Close()
+	}
+	return nil
+}
@@ -5,13 +5,32 @@ import (
 	"math"
 	"strconv"
 
+	"github.com/braheezy/bubblelife/life"
 	"github.com/go-gl/glfw/v3.3/glfw"
 	"github.com/go-gl/mathgl/mgl32"
 )
 
 const (
 	menuY   = float32(100.0)
-	spacing = float32(30.0)
+	spacing = float32(26.0)
+	// number of selectable settings in the menu
+	menuOptions = 17
+	// most generations that can be skipped in worlds that step one generation at a time
+	maxSteppedSkip = 10000
+	// how much the lenia growth function changes with each arrow press
+	leniaMuStep    = 0.005
+	leniaSigmaStep = 0.001
+	// how many generations each arrow press scrubs through the history
+	historyScrub = 10
+	// how much the seeder's shares, and its sizes in cells, change with each arrow press
+	seederShareStep = 0.05
+	seederSizeStep  = 0.5
+	// number of generations the graph shows, and where it sits in the top right corner
+	graphGenerations = 300
+	graphWidth       = float32(300.0)
+	graphHeight      = float32(90.0)
+	graphX           = float32(windowWidth) - graphWidth - 5.0
+	graphY           = float32(5.0)
 )
 
 // Variables to store UI state
@@ -19,7 +38,7 @@ var (
 	// Toggles whether the UI is shown or not
 	showUI = false
 	// Set default UI values to scene values
-	uiN, uiM          = pillarN, pillarM
+	uiN, uiM, uiK     = pillarN, pillarM, pillarK
 	uiSeed            = initialSeed
 	uiGenerationSpeed = generationSpeed
 
@@ -41,19 +60,99 @@ var (
 	backspacePressed bool
 	enterPressed     bool
 	shiftPressed     bool
+	spacePressed     bool
+	commaPressed     bool
+	periodPressed    bool
+	f2Pressed        bool
+	f3Pressed        bool
+	f4Pressed        bool
+	f5Pressed        bool
+	f9Pressed        bool
 
 	// Buffer to store typed input for the seed
 	inputBuffer string
+	// Buffer to store typed input for the rule, and why the last typed rule was rejected
+	ruleInputBuffer string
+	ruleError       string
+	// Buffer to store the typed number of generations to skip ahead, and how many generations the
+	// main loop should skip ahead next frame
+	skipInputBuffer string
+	skipGenerations int
+	// how many generations the main loop should step forwards, one each frame, and go back next
+	// frame
+	stepGenerations   int
+	rewindGenerations int
+	// Keys that can be typed into a rule, and the character they produce
+	ruleKeys = map[glfw.Key]byte{
+		glfw.Key0: '0', glfw.Key1: '1', glfw.Key2: '2', glfw.Key3: '3', glfw.Key4: '4',
+		glfw.Key5: '5', glfw.Key6: '6', glfw.Key7: '7', glfw.Key8: '8', glfw.Key9: '9',
+		glfw.KeyB: 'B', glfw.KeyS: 'S', glfw.KeySlash: '/', glfw.KeyMinus: '-', glfw.KeyComma: ',',
+		glfw.KeyN: 'N', glfw.KeyM: 'M', glfw.KeyE: 'E', glfw.KeyV: 'V', glfw.KeyC: 'C',
+		glfw.KeyK: 'K', glfw.KeyP: 'P', glfw.KeyPeriod: '.',
+	}
 	// currently selected UI element
 	selectedOption = 0
+	// which of the seeder's settings the arrow keys change
+	seederSetting = 0
+
+	// well known 3D rules that can be cycled through
+	rulePresets = []life.Rule{
+		life.DefaultRule,
+		life.MustParseRule("4555"),
+		life.MustParseRule("5766"),
+		life.MustParseRule("B4/S4"),
+		life.MustParseRule("B4-7/S6-8"),
+		life.MustParseRule("B13-19/S13-26"),
+		// Generations rules, whose dying bubbles shrink and fade
+		life.MustParseRule("B6-8/S4-7/C10"),
+		life.MustParseRule("B5-7,12-13,15/S9-26/C5"),
+		// Rules with several species, whose bubbles keep the color of their species
+		life.MustParseRule("B5-7/S4-9/K4"),
+		life.MustParseRule("B5/S4-5/K2"),
+		// Stochastic rules, which roll their dice from the seed
+		life.MustParseRule("B5-7/S4-9/PB0.9/PS0.95"),
+		life.MustParseRule("B6-7/S5-8/PN0.0005"),
+	}
+	// neighborhoods that can be cycled through
+	neighborhoodPresets = []life.Neighborhood{
+		life.MooreNeighborhood,
+		{Kind: life.FaceEdge, Radius: 1},
+		{Kind: life.VonNeumann, Radius: 1},
+		{Kind: life.Moore, Radius: 2},
+		{Kind: life.FaceEdge, Radius: 2},
+		{Kind: life.VonNeumann, Radius: 2},
+		{Kind: life.VonNeumann, Radius: 3},
+	}
+	// boundaries that can be cycled through
+	boundaryPresets = []life.Boundary{
+		life.Torus,
+		life.MustParseBoundary("dead"),
+		life.MustParseBoundary("alive"),
+		life.MustParseBoundary("reflect"),
+		// wraps horizontally with a solid floor and an open ceiling
+		life.MustParseBoundary("periodic,alive:dead,periodic"),
+		// a tube that wraps vertically inside dead walls
+		life.MustParseBoundary("dead,periodic,dead"),
+	}
+	// lattices that can be cycled through
+	latticePresets = []life.Lattice{life.Cubic, life.FCC, life.HCP}
+	// axes the mirror seeder can be cycled through
+	seederAxesPresets = []string{"x", "y", "z", "xy", "xz", "yz", "xyz"}
 )
 
 // renderUI renders the simple overlay menu when the user presses Tab.
-func renderUI(text *TextRenderer, bubble []*Bubble, fps float64, aliveCount int, generation int) {
+func renderUI(text *TextRenderer, bubble []*Bubble, fps float64, aliveCount int, generation int, verdict life.Verdict) {
 	// scene stats
 	text.RenderText(fmt.Sprintf("FPS: %.2f", fps), 5.0, 5.0, 1.0, textColor)
 	text.RenderText(fmt.Sprintf("bubbles: %d/%d", aliveCount, len(bubble)), 5.0, 30.0, 1.0, textColor)
-	text.RenderText(fmt.Sprintf("generation #: %d", generation), 5.0, 60.0, 1.0, textColor)
+	generationText := fmt.Sprintf("generation #: %d", generation)
+	if verdict.Settled() {
+		generationText += fmt.Sprintf(" (%s since #%d)", verdict, verdict.Since)
+	}
+	if paused {
+		generationText += " paused"
+	}
+	text.RenderText(generationText, 5.0, 60.0, 1.0, textColor)
 
 	// Display the menu title
 	text.RenderText("settings (tab to toggle, arrow keys to navigate)", 5.0, menuY, 1.0, textColor)
@@ -72,24 +171,299 @@ func renderUI(text *TextRenderer, bubble []*Bubble, fps float64, aliveCount int,
 		text.RenderText(fmt.Sprintf("pillar heigh: %d", uiM), 5.0, menuY+2*spacing, 1.0, textColor)
 	}
 
-	// Seed
+	// Pillar Size - K
 	if selectedOption == 2 {
+		text.RenderText(fmt.Sprintf("pillar depth: %d", uiK), 5.0, menuY+3*spacing, 1.2, highlightColor)
+	} else {
+		text.RenderText(fmt.Sprintf("pillar depth: %d", uiK), 5.0, menuY+3*spacing, 1.0, textColor)
+	}
+
+	// Seed
+	if selectedOption == 3 {
 		if len(inputBuffer) > 0 {
-			text.RenderText(fmt.Sprintf("seed: %s", inputBuffer), 5.0, menuY+3*spacing, 1.2, highlightColor)
+			text.RenderText(fmt.Sprintf("seed: %s", inputBuffer), 5.0, menuY+4*spacing, 1.2, highlightColor)
 		} else {
-			text.RenderText(fmt.Sprintf("seed: %d", uiSeed), 5.0, menuY+3*spacing, 1.2, highlightColor)
+			text.RenderText(fmt.Sprintf("seed: %d", uiSeed), 5.0, menuY+4*spacing, 1.2, highlightColor)
 		}
 	} else {
-		text.RenderText(fmt.Sprintf("seed: %d", uiSeed), 5.0, menuY+3*spacing, 1.0, textColor)
+		text.RenderText(fmt.Sprintf("seed: %d", uiSeed), 5.0, menuY+4*spacing, 1.0, textColor)
 	}
 
 	// Generation Speed
-	if selectedOption == 3 {
-		text.RenderText(fmt.Sprintf("generation rate: %.2f sec", uiGenerationSpeed), 5.0, menuY+4*spacing, 1.2, highlightColor)
+	if selectedOption == 4 {
+		text.RenderText(fmt.Sprintf("generation rate: %.2f sec", uiGenerationSpeed), 5.0, menuY+5*spacing, 1.2, highlightColor)
+	} else {
+		text.RenderText(fmt.Sprintf("generation rate: %.2f sec", uiGenerationSpeed), 5.0, menuY+5*spacing, 1.0, textColor)
+	}
+
+	// Rule
+	if selectedOption == 5 {
+		if len(ruleInputBuffer) > 0 {
+			text.RenderText(fmt.Sprintf("rule: %s", ruleInputBuffer), 5.0, menuY+6*spacing, 1.2, highlightColor)
+		} else {
+			text.RenderText(fmt.Sprintf("rule: %s", rule), 5.0, menuY+6*spacing, 1.2, highlightColor)
+		}
+	} else {
+		text.RenderText(fmt.Sprintf("rule: %s", rule), 5.0, menuY+6*spacing, 1.0, textColor)
+	}
+
+	// Neighborhood
+	if selectedOption == 6 {
+		text.RenderText(fmt.Sprintf("neighborhood: %s", rule.Neighborhood.Name()), 5.0, menuY+7*spacing, 1.2, highlightColor)
+	} else {
+		text.RenderText(fmt.Sprintf("neighborhood: %s", rule.Neighborhood.Name()), 5.0, menuY+7*spacing, 1.0, textColor)
+	}
+
+	// Boundary
+	if selectedOption == 7 {
+		text.RenderText(fmt.Sprintf("boundary: %s", boundary), 5.0, menuY+8*spacing, 1.2, highlightColor)
+	} else {
+		text.RenderText(fmt.Sprintf("boundary: %s", boundary), 5.0, menuY+8*spacing, 1.0, textColor)
+	}
+
+	// Universe
+	if selectedOption == 8 {
+		text.RenderText(fmt.Sprintf("universe: %s", universe), 5.0, menuY+9*spacing, 1.2, highlightColor)
+	} else {
+		text.RenderText(fmt.Sprintf("universe: %s", universe), 5.0, menuY+9*spacing, 1.0, textColor)
+	}
+
+	// Skip ahead
+	skipText := "skip ahead: type generations, enter to jump"
+	if skipInputBuffer != "" {
+		skipText = fmt.Sprintf("skip ahead: %s", skipInputBuffer)
+	}
+	if selectedOption == 9 {
+		text.RenderText(skipText, 5.0, menuY+10*spacing, 1.2, highlightColor)
 	} else {
-		text.RenderText(fmt.Sprintf("generation rate: %.2f sec", uiGenerationSpeed), 5.0, menuY+4*spacing, 1.0, textColor)
+		text.RenderText("skip ahead", 5.0, menuY+10*spacing, 1.0, textColor)
 	}
 
+	// Lenia growth function
+	if selectedOption == 10 {
+		text.RenderText(fmt.Sprintf("lenia mu: %.3f", leniaParams.Mu), 5.0, menuY+11*spacing, 1.2, highlightColor)
+	} else {
+		text.RenderText(fmt.Sprintf("lenia mu: %.3f", leniaParams.Mu), 5.0, menuY+11*spacing, 1.0, textColor)
+	}
+	if selectedOption == 11 {
+		text.RenderText(fmt.Sprintf("lenia sigma: %.3f", leniaParams.Sigma), 5.0, menuY+12*spacing, 1.2, highlightColor)
+	} else {
+		text.RenderText(fmt.Sprintf("lenia sigma: %.3f", leniaParams.Sigma), 5.0, menuY+12*spacing, 1.0, textColor)
+	}
+
+	// Lattice
+	if selectedOption == 12 {
+		text.RenderText(fmt.Sprintf("lattice: %s", lattice), 5.0, menuY+13*spacing, 1.2, highlightColor)
+	} else {
+		text.RenderText(fmt.Sprintf("lattice: %s", lattice), 5.0, menuY+13*spacing, 1.0, textColor)
+	}
+
+	// Stagnation action
+	if selectedOption == 13 {
+		text.RenderText(fmt.Sprintf("on stagnation: %s", onStagnation), 5.0, menuY+14*spacing, 1.2, highlightColor)
+	} else {
+		text.RenderText(fmt.Sprintf("on stagnation: %s", onStagnation), 5.0, menuY+14*spacing, 1.0, textColor)
+	}
+
+	// History
+	historyText := "history: empty"
+	if oldest, ok := history.Oldest(); ok {
+		historyText = fmt.Sprintf("history: %d generations back to #%d", history.Len(), oldest)
+	}
+	if selectedOption == 14 {
+		text.RenderText(historyText, 5.0, menuY+15*spacing, 1.2, highlightColor)
+	} else {
+		text.RenderText(historyText, 5.0, menuY+15*spacing, 1.0, textColor)
+	}
+
+	// Seeder
+	if selectedOption == 15 {
+		text.RenderText(fmt.Sprintf("seeder: %s", seeder.Kind), 5.0, menuY+16*spacing, 1.2, highlightColor)
+	} else {
+		text.RenderText(fmt.Sprintf("seeder: %s", seeder.Kind), 5.0, menuY+16*spacing, 1.0, textColor)
+	}
+	seederText := "seeder settings: none"
+	if settings := seeder.Settings(); len(settings) > 0 {
+		name := settings[seederSetting%len(settings)]
+		seederText = fmt.Sprintf("seeder %s: %s (enter for next)", name, seeder.Setting(name))
+	}
+	if selectedOption == 16 {
+		text.RenderText(seederText, 5.0, menuY+17*spacing, 1.2, highlightColor)
+	} else {
+		text.RenderText(seederText, 5.0, menuY+17*spacing, 1.0, textColor)
+	}
+
+	if ruleError != "" {
+		text.RenderText(ruleError, 5.0, menuY+18*spacing, 0.6, highlightColor)
+	}
+}
+
+// renderGraph charts the population, births and deaths of the last recorded generations next to
+// the stats text. The chart fills up from the left and scrolls once it is full, scaled to the
+// largest value it shows.
+func renderGraph(text *TextRenderer, graph *GraphRenderer, stats []life.Stats) {
+	stats = stats[max(len(stats)-graphGenerations, 0):]
+	population := make([]float32, len(stats))
+	births := make([]float32, len(stats))
+	deaths := make([]float32, len(stats))
+	top := float32(0)
+	for i, s := range stats {
+		population[i], births[i], deaths[i] = float32(s.Population), float32(s.Births), float32(s.Deaths)
+		top = max(top, population[i], births[i], deaths[i])
+	}
+
+	graph.RenderRect(graphX, graphY, graphWidth, graphHeight, mgl32.Vec3{0.0, 0.0, 0.0}, 0.5)
+	legendHeight := float32(18.0)
+	chartY, chartHeight := graphY+legendHeight, graphHeight-legendHeight-4.0
+	step := graphWidth / float32(graphGenerations-1)
+	graph.RenderLine(population, top, graphX, chartY, graphWidth, chartHeight, step, textColor)
+	graph.RenderLine(births, top, graphX, chartY, graphWidth, chartHeight, step, iris)
+	graph.RenderLine(deaths, top, graphX, chartY, graphWidth, chartHeight, step, highlightColor)
+
+	// The legend doubles as the latest values
+	var last life.Stats
+	if len(stats) > 0 {
+		last = stats[len(stats)-1]
+	}
+	text.RenderText(fmt.Sprintf("population %d", last.Population), graphX+4.0, graphY+4.0, 0.5, textColor)
+	text.RenderText(fmt.Sprintf("births %d", last.Births), graphX+124.0, graphY+4.0, 0.5, iris)
+	text.RenderText(fmt.Sprintf("deaths %d", last.Deaths), graphX+214.0, graphY+4.0, 0.5, highlightColor)
+}
+
+// nextUniverse returns the universe after (or before, for a negative step) the current one.
+func nextUniverse(current string, step int) string {
+	index := 0
+	for i, u := range universes {
+		if u == current {
+			index = i
+			break
+		}
+	}
+	return universes[(index+step+len(universes))%len(universes)]
+}
+
+// nextStagnationAction returns the stagnation action after (or before, for a negative step) the
+// current one, skipping actions the universe can't carry out.
+func nextStagnationAction(current string, step int) string {
+	index := 0
+	for i, action := range stagnationActions {
+		if action == current {
+			index = i
+			break
+		}
+	}
+	for {
+		index = (index + step + len(stagnationActions)) % len(stagnationActions)
+		if checkStagnation(stagnationActions[index], universe) == nil {
+			return stagnationActions[index]
+		}
+	}
+}
+
+// nextLattice returns the lattice after (or before, for a negative step) the current one.
+func nextLattice(current life.Lattice, step int) life.Lattice {
+	index := 0
+	for i, l := range latticePresets {
+		if l == current {
+			index = i
+			break
+		}
+	}
+	return latticePresets[(index+step+len(latticePresets))%len(latticePresets)]
+}
+
+// nextSeederKind returns the kind of seeder after (or before, for a negative step) the current
+// one.
+func nextSeederKind(current life.SeederKind, step int) life.SeederKind {
+	index := 0
+	for i, kind := range life.SeederKinds {
+		if kind == current {
+			index = i
+			break
+		}
+	}
+	return life.SeederKinds[(index+step+len(life.SeederKinds))%len(life.SeederKinds)]
+}
+
+// nudgeSeeder returns the seeder with one of its settings a step up (or down, for a negative
+// step), kept to values it can seed with.
+func nudgeSeeder(s life.Seeder, setting string, step int) life.Seeder {
+	change := float64(step)
+	switch setting {
+	case "density":
+		s.Density = min(1, max(0, s.Density+change*seederShareStep))
+	case "radius":
+		s.Radius = max(seederShareStep, s.Radius+change*seederShareStep)
+	case "scale":
+		s.Scale = max(seederSizeStep, s.Scale+change*seederSizeStep)
+	case "threshold":
+		s.Threshold = min(1, max(0, s.Threshold+change*seederShareStep))
+	case "count":
+		s.Count = min(life.MaxSeederCount, max(1, s.Count+step))
+	case "spread":
+		s.Spread = max(seederSizeStep, s.Spread+change*seederSizeStep)
+	case "axes":
+		index := 0
+		for i, axes := range seederAxesPresets {
+			if axes == s.Axes {
+				index = i
+				break
+			}
+		}
+		s.Axes = seederAxesPresets[(index+step+len(seederAxesPresets))%len(seederAxesPresets)]
+	}
+	return s
+}
+
+// nextNeighborhoodPreset returns the neighborhood preset after (or before, for a negative step)
+// the current neighborhood.
+func nextNeighborhoodPreset(current life.Neighborhood, step int) life.Neighborhood {
+	index := 0
+	for i, preset := range neighborhoodPresets {
+		if preset == current {
+			index = i
+			break
+		}
+	}
+	return neighborhoodPresets[(index+step+len(neighborhoodPresets))%len(neighborhoodPresets)]
+}
+
+// nextBoundaryPreset returns the boundary preset after (or before, for a negative step) the
+// current boundary. A custom boundary steps to the first or last preset.
+func nextBoundaryPreset(current life.Boundary, step int) life.Boundary {
+	index := -1
+	for i, preset := range boundaryPresets {
+		if preset == current {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		if step > 0 {
+			return boundaryPresets[0]
+		}
+		return boundaryPresets[len(boundaryPresets)-1]
+	}
+	return boundaryPresets[(index+step+len(boundaryPresets))%len(boundaryPresets)]
+}
+
+// nextRulePreset returns the preset after (or before, for a negative step) the current rule.
+// A custom rule that isn't a preset steps to the first or last preset.
+func nextRulePreset(current life.Rule, step int) life.Rule {
+	index := -1
+	for i, preset := range rulePresets {
+		if preset.Equal(current) {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		if step > 0 {
+			return rulePresets[0]
+		}
+		return rulePresets[len(rulePresets)-1]
+	}
+	return rulePresets[(index+step+len(rulePresets))%len(rulePresets)]
 }
 
 // Helper function to validate and clamp the seed value between 1 and int64
@@ -123,7 +497,7 @@ func processInput(w *glfw.Window) {
 		//* Navigate UI items using Up/Down
 		if w.GetKey(glfw.KeyDown) == glfw.Press && !downPressed {
 			// Move down (wrap around)
-			selectedOption = (selectedOption + 1) % 4
+			selectedOption = (selectedOption + 1) % menuOptions
 			downPressed = true
 		}
 		if w.GetKey(glfw.KeyDown) == glfw.Release {
@@ -132,7 +506,7 @@ func processInput(w *glfw.Window) {
 
 		if w.GetKey(glfw.KeyUp) == glfw.Press && !upPressed {
 			// Move up (wrap around)
-			selectedOption = (selectedOption - 1 + 4) % 4
+			selectedOption = (selectedOption - 1 + menuOptions) % menuOptions
 			upPressed = true
 		}
 		if w.GetKey(glfw.KeyUp) == glfw.Release {
@@ -164,7 +538,19 @@ func processInput(w *glfw.Window) {
 				rightPressed = true
 				pillarChanged = true
 			}
-		} else if selectedOption == 2 { //* Seed input
+		} else if selectedOption == 2 { //* Pillar Size K
+			if w.GetKey(glfw.KeyLeft) == glfw.Press && !leftPressed {
+				// Decrease K, but not below 1 so the pillar can be a flat slab
+				uiK = max(1, uiK-1)
+				leftPressed = true
+				pillarChanged = true
+			}
+			if w.GetKey(glfw.KeyRight) == glfw.Press && !rightPressed {
+				uiK++
+				rightPressed = true
+				pillarChanged = true
+			}
+		} else if selectedOption == 3 { //* Seed input
 			// Handle numerical input for the seed
 			for key := glfw.Key0; key <= glfw.Key9; key++ {
 				// Check if the key is pressed and hasn't been handled yet
@@ -198,7 +584,7 @@ func processInput(w *glfw.Window) {
 			if w.GetKey(glfw.KeyEnter) == glfw.Release {
 				enterPressed = false
 			}
-		} else if selectedOption == 3 { //* Generation speed
+		} else if selectedOption == 4 { //* Generation speed
 			if w.GetKey(glfw.KeyLeft) == glfw.Press && !leftPressed {
 				uiGenerationSpeed = max(0, uiGenerationSpeed-1)
 				leftPressed = true
@@ -208,6 +594,239 @@ func processInput(w *glfw.Window) {
 				rightPressed = true
 			}
 			generationSpeed = uiGenerationSpeed
+		} else if selectedOption == 5 { //* Rule
+			// Cycle through the preset rules
+			if w.GetKey(glfw.KeyLeft) == glfw.Press && !leftPressed {
+				ruleInputBuffer, ruleError = "", ""
+				if err := setRule(nextRulePreset(rule, -1)); err != nil {
+					ruleError = err.Error()
+				}
+				leftPressed = true
+			}
+			if w.GetKey(glfw.KeyRight) == glfw.Press && !rightPressed {
+				ruleInputBuffer, ruleError = "", ""
+				if err := setRule(nextRulePreset(rule, 1)); err != nil {
+					ruleError = err.Error()
+				}
+				rightPressed = true
+			}
+
+			// Handle typed input for a custom rule
+			for key, char := range ruleKeys {
+				if w.GetKey(key) == glfw.Press && !numberKeyPressed[key] {
+					ruleInputBuffer += string(char)
+					numberKeyPressed[key] = true
+				}
+				if w.GetKey(key) == glfw.Release {
+					numberKeyPressed[key] = false
+				}
+			}
+
+			// Backspace key to delete last character (with debounce)
+			if w.GetKey(glfw.KeyBackspace) == glfw.Press && !backspacePressed && len(ruleInputBuffer) > 0 {
+				ruleInputBuffer = ruleInputBuffer[:len(ruleInputBuffer)-1]
+				backspacePressed = true
+			}
+			if w.GetKey(glfw.KeyBackspace) == glfw.Release {
+				backspacePressed = false
+			}
+
+			// Enter key to confirm the rule input (with debounce). Invalid rules are kept in the
+			// buffer so they can be fixed.
+			if w.GetKey(glfw.KeyEnter) == glfw.Press && !enterPressed && len(ruleInputBuffer) > 0 {
+				if r, err := life.ParseRule(ruleInputBuffer); err != nil {
+					ruleError = err.Error()
+				} else if err := setRule(r); err != nil {
+					ruleError = err.Error()
+				} else {
+					ruleInputBuffer, ruleError = "", ""
+				}
+				enterPressed = true
+			}
+			if w.GetKey(glfw.KeyEnter) == glfw.Release {
+				enterPressed = false
+			}
+		} else if selectedOption == 6 { //* Neighborhood
+			// Keep the rule's counts, but count them over a different neighborhood
+			if w.GetKey(glfw.KeyLeft) == glfw.Press && !leftPressed {
+				if err := setRule(rule.WithNeighborhood(nextNeighborhoodPreset(rule.Neighborhood, -1))); err != nil {
+					ruleError = err.Error()
+				}
+				leftPressed = true
+			}
+			if w.GetKey(glfw.KeyRight) == glfw.Press && !rightPressed {
+				if err := setRule(rule.WithNeighborhood(nextNeighborhoodPreset(rule.Neighborhood, 1))); err != nil {
+					ruleError = err.Error()
+				}
+				rightPressed = true
+			}
+		} else if selectedOption == 7 { //* Boundary
+			if w.GetKey(glfw.KeyLeft) == glfw.Press && !leftPressed {
+				setBoundary(nextBoundaryPreset(boundary, -1))
+				leftPressed = true
+			}
+			if w.GetKey(glfw.KeyRight) == glfw.Press && !rightPressed {
+				setBoundary(nextBoundaryPreset(boundary, 1))
+				rightPressed = true
+			}
+		} else if selectedOption == 8 { //* Universe
+			// Cycle through the pillar, the packed pillar and the infinite universes
+			step := 0
+			if w.GetKey(glfw.KeyLeft) == glfw.Press && !leftPressed {
+				step = -1
+				leftPressed = true
+			}
+			if w.GetKey(glfw.KeyRight) == glfw.Press && !rightPressed {
+				step = 1
+				rightPressed = true
+			}
+			if step != 0 {
+				next := nextUniverse(universe, step)
+				err := checkUniverse(next, rule, lattice)
+				if err == nil {
+					err = checkStagnation(onStagnation, next)
+				}
+				if err != nil {
+					ruleError = err.Error()
+				} else {
+					universe = next
+					ruleError = ""
+					pillarChanged = true
+				}
+			}
+		} else if selectedOption == 9 { //* Skip ahead
+			for key := glfw.Key0; key <= glfw.Key9; key++ {
+				if w.GetKey(key) == glfw.Press && !numberKeyPressed[key] {
+					skipInputBuffer += string(rune('0' + key - glfw.Key0))
+					numberKeyPressed[key] = true
+				}
+				if w.GetKey(key) == glfw.Release {
+					numberKeyPressed[key] = false
+				}
+			}
+
+			if w.GetKey(glfw.KeyBackspace) == glfw.Press && !backspacePressed && len(skipInputBuffer) > 0 {
+				skipInputBuffer = skipInputBuffer[:len(skipInputBuffer)-1]
+				backspacePressed = true
+			}
+			if w.GetKey(glfw.KeyBackspace) == glfw.Release {
+				backspacePressed = false
+			}
+
+			if w.GetKey(glfw.KeyEnter) == glfw.Press && !enterPressed && len(skipInputBuffer) > 0 {
+				n, err := strconv.Atoi(skipInputBuffer)
+				// Worlds that can't jump step every generation, so keep them to a sane number
+				_, jumper := world.(life.Jumper)
+				if err != nil || n < 1 || (!jumper && n > maxSteppedSkip) {
+					ruleError = fmt.Sprintf("can skip 1 to %d generations, or any number in the hashlife universe", maxSteppedSkip)
+				} else {
+					skipGenerations = n
+					ruleError = ""
+				}
+				skipInputBuffer = ""
+				enterPressed = true
+			}
+			if w.GetKey(glfw.KeyEnter) == glfw.Release {
+				enterPressed = false
+			}
+		} else if selectedOption == 10 || selectedOption == 11 { //* Lenia mu and sigma
+			change := 0.0
+			if w.GetKey(glfw.KeyLeft) == glfw.Press && !leftPressed {
+				change = -1
+				leftPressed = true
+			}
+			if w.GetKey(glfw.KeyRight) == glfw.Press && !rightPressed {
+				change = 1
+				rightPressed = true
+			}
+			if change != 0 {
+				p := leniaParams
+				if selectedOption == 10 {
+					p.Mu = max(0, p.Mu+change*leniaMuStep)
+				} else {
+					p.Sigma = max(leniaSigmaStep, p.Sigma+change*leniaSigmaStep)
+				}
+				if err := setLeniaParams(p); err != nil {
+					ruleError = err.Error()
+				}
+			}
+		} else if selectedOption == 12 { //* Lattice
+			// The bubbles move to their new places, so the pillar starts over
+			step := 0
+			if w.GetKey(glfw.KeyLeft) == glfw.Press && !leftPressed {
+				step = -1
+				leftPressed = true
+			}
+			if w.GetKey(glfw.KeyRight) == glfw.Press && !rightPressed {
+				step = 1
+				rightPressed = true
+			}
+			if step != 0 {
+				next := nextLattice(lattice, step)
+				if err := checkUniverse(universe, rule, next); err != nil {
+					ruleError = err.Error()
+				} else {
+					lattice = next
+					ruleError = ""
+					pillarChanged = true
+				}
+			}
+		} else if selectedOption == 13 { //* Stagnation action
+			if w.GetKey(glfw.KeyLeft) == glfw.Press && !leftPressed {
+				onStagnation = nextStagnationAction(onStagnation, -1)
+				leftPressed = true
+			}
+			if w.GetKey(glfw.KeyRight) == glfw.Press && !rightPressed {
+				onStagnation = nextStagnationAction(onStagnation, 1)
+				rightPressed = true
+			}
+		} else if selectedOption == 14 { //* Scrub through the history
+			if w.GetKey(glfw.KeyLeft) == glfw.Press && !leftPressed {
+				paused = true
+				rewindGenerations += historyScrub
+				leftPressed = true
+			}
+			if w.GetKey(glfw.KeyRight) == glfw.Press && !rightPressed {
+				paused = true
+				stepGenerations += historyScrub
+				rightPressed = true
+			}
+		} else if selectedOption == 15 { //* Seeder
+			// Each kind starts from its own settings, and the pillar starts over from it
+			if w.GetKey(glfw.KeyLeft) == glfw.Press && !leftPressed {
+				seeder = life.NewSeeder(nextSeederKind(seeder.Kind, -1))
+				seederSetting = 0
+				pillarChanged = true
+				leftPressed = true
+			}
+			if w.GetKey(glfw.KeyRight) == glfw.Press && !rightPressed {
+				seeder = life.NewSeeder(nextSeederKind(seeder.Kind, 1))
+				seederSetting = 0
+				pillarChanged = true
+				rightPressed = true
+			}
+		} else if selectedOption == 16 { //* Seeder settings
+			settings := seeder.Settings()
+			if w.GetKey(glfw.KeyEnter) == glfw.Press && !enterPressed {
+				seederSetting++
+				enterPressed = true
+			}
+			if w.GetKey(glfw.KeyEnter) == glfw.Release {
+				enterPressed = false
+			}
+			step := 0
+			if w.GetKey(glfw.KeyLeft) == glfw.Press && !leftPressed {
+				step = -1
+				leftPressed = true
+			}
+			if w.GetKey(glfw.KeyRight) == glfw.Press && !rightPressed {
+				step = 1
+				rightPressed = true
+			}
+			if step != 0 && len(settings) > 0 {
+				seeder = nudgeSeeder(seeder, settings[seederSetting%len(settings)], step)
+				pillarChanged = true
+			}
 		}
 
 		// Release left/right key press flags
@@ -220,22 +839,98 @@ func processInput(w *glfw.Window) {
 
 		// If the pillar size changed or the seed was updated, recreate the pillar
 		if pillarChanged {
-			recreatePillar(uiN, uiM)
+			recreatePillar(uiN, uiM, uiK)
+		}
+	}
+
+	// Handle camera movement when UI is not being shown. Letters typed into a rule
+	// shouldn't move the camera.
+	if !showUI || selectedOption != 5 {
+		if w.GetKey(glfw.KeyW) == glfw.Press {
+			camera.processKeyboard(FORWARD, float32(deltaTime))
+		}
+		if w.GetKey(glfw.KeyS) == glfw.Press {
+			camera.processKeyboard(BACKWARD, float32(deltaTime))
+		}
+		if w.GetKey(glfw.KeyA) == glfw.Press {
+			camera.processKeyboard(LEFT, float32(deltaTime))
 		}
+		if w.GetKey(glfw.KeyD) == glfw.Press {
+			camera.processKeyboard(RIGHT, float32(deltaTime))
+		}
+	}
+
+	//* Pause and resume on space
+	if w.GetKey(glfw.KeySpace) == glfw.Press && !spacePressed {
+		spacePressed = true
+		paused = !paused
+	}
+	if w.GetKey(glfw.KeySpace) == glfw.Release {
+		spacePressed = false
+	}
+
+	//* Step one generation forwards on period and backwards on comma, unless they're being typed
+	// into a rule. Stepping pauses the world so the step can be looked at.
+	if !showUI || selectedOption != 5 {
+		if w.GetKey(glfw.KeyPeriod) == glfw.Press && !periodPressed {
+			periodPressed = true
+			paused = true
+			stepGenerations++
+		}
+		if w.GetKey(glfw.KeyComma) == glfw.Press && !commaPressed {
+			commaPressed = true
+			paused = true
+			rewindGenerations++
+		}
+	}
+	if w.GetKey(glfw.KeyPeriod) == glfw.Release {
+		periodPressed = false
+	}
+	if w.GetKey(glfw.KeyComma) == glfw.Release {
+		commaPressed = false
+	}
+
+	//* Export the recorded stats on F2
+	if w.GetKey(glfw.KeyF2) == glfw.Press && !f2Pressed {
+		f2Pressed = true
+		exportStats()
+	}
+	if w.GetKey(glfw.KeyF2) == glfw.Release {
+		f2Pressed = false
+	}
+
+	//* Export the live cells as a MagicaVoxel model on F3
+	if w.GetKey(glfw.KeyF3) == glfw.Press && !f3Pressed {
+		f3Pressed = true
+		exportVox()
+	}
+	if w.GetKey(glfw.KeyF3) == glfw.Release {
+		f3Pressed = false
+	}
+
+	//* Export the live cells as a mesh on F4
+	if w.GetKey(glfw.KeyF4) == glfw.Press && !f4Pressed {
+		f4Pressed = true
+		exportMesh()
+	}
+	if w.GetKey(glfw.KeyF4) == glfw.Release {
+		f4Pressed = false
 	}
 
-	// Handle camera movement when UI is not being shown
-	if w.GetKey(glfw.KeyW) == glfw.Press {
-		camera.processKeyboard(FORWARD, float32(deltaTime))
+	//* Save the session on F5 and load it back on F9
+	if w.GetKey(glfw.KeyF5) == glfw.Press && !f5Pressed {
+		f5Pressed = true
+		saveSession()
 	}
-	if w.GetKey(glfw.KeyS) == glfw.Press {
-		camera.processKeyboard(BACKWARD, float32(deltaTime))
+	if w.GetKey(glfw.KeyF5) == glfw.Release {
+		f5Pressed = false
 	}
-	if w.GetKey(glfw.KeyA) == glfw.Press {
-		camera.processKeyboard(LEFT, float32(deltaTime))
+	if w.GetKey(glfw.KeyF9) == glfw.Press && !f9Pressed {
+		f9Pressed = true
+		loadSession()
 	}
-	if w.GetKey(glfw.KeyD) == glfw.Press {
-		camera.processKeyboard(RIGHT, float32(deltaTime))
+	if w.GetKey(glfw.KeyF9) == glfw.Release {
+		f9Pressed = false
 	}
 
 	// Allow escaping window
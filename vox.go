@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"os"
+	"time"
+
+	"github.com/braheezy/bubblelife/life"
+	"github.com/go-gl/mathgl/mgl32"
+)
+
+// the MagicaVoxel model new worlds start from, if any
+var voxModel *life.Vox
+
+// loadVox reads a MagicaVoxel model from a file.
+func loadVox(path string) (*life.Vox, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	v, err := life.ReadVox(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &v, nil
+}
+
+// placeVox makes the cells of the model's voxels alive.
+func placeVox(w life.World) {
+	if voxModel == nil {
+		return
+	}
+	for _, voxel := range voxModel.Voxels {
+		w.Set(voxel.Point, true)
+	}
+}
+
+// voxSpecies gives the cells of the model's voxels a species by their palette index, wrapping
+// around when there are more indices than species.
+func voxSpecies(w life.Multispecies) {
+	if voxModel == nil || rule.Species < 2 {
+		return
+	}
+	for _, voxel := range voxModel.Voxels {
+		if w.Alive(voxel.Point) {
+			w.SetSpecies(voxel.Point, (int(voxel.Index)-1)%rule.Species+1)
+		}
+	}
+}
+
+// paintVoxels shows the model's bubbles in the colors of their voxels until the world moves on
+// and they take the colors of their groups. Species keep their own colors.
+func paintVoxels() {
+	if voxModel == nil || world == nil || world.Generation() != 0 || rule.Species > 1 {
+		return
+	}
+	for _, voxel := range voxModel.Voxels {
+		if bubble, ok := bubbleIndex[voxel.Point]; ok && bubble.CurrentState {
+			c := voxModel.Palette[voxel.Index]
+			bubble.Color = mgl32.Vec3{float32(c.R) / 255.0, float32(c.G) / 255.0, float32(c.B) / 255.0}
+		}
+	}
+}
+
+// exportVox writes the live cells shown to a .vox file, in the colors of their bubbles.
+func exportVox() {
+	v := worldVox(world, func(p life.Point) mgl32.Vec3 {
+		if bubble, ok := bubbleIndex[p]; ok {
+			return bubble.shownColor()
+		}
+		return textColor
+	})
+	path := fmt.Sprintf("bubblelife-%s.vox", time.Now().Format("20060102-150405"))
+	if err := writeVox(path, v); err != nil {
+		ruleError = fmt.Sprintf("couldn't export cells: %v", err)
+		return
+	}
+	ruleError = fmt.Sprintf("wrote %d cells to %s", len(v.Voxels), path)
+}
+
+// writeVox writes a model to a file.
+func writeVox(path string, v life.Vox) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := life.WriteVox(file, v); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// worldVox makes a model of the live cells of a world, painted in the colors colorOf gives them.
+// Bounded worlds keep the size of their box, and others are cropped to their live cells. Once the
+// palette is full, cells take the closest color in it. Under rules with several species, the
+// palette index is the species.
+func worldVox(w life.World, colorOf func(life.Point) mgl32.Vec3) life.Vox {
+	cells := w.LiveCells()
+	var v life.Vox
+	var origin life.Point
+	if bounded, ok := w.(life.Bounded); ok {
+		v.Size = bounded.Size()
+	} else if len(cells) > 0 {
+		lo, hi := cells[0], cells[0]
+		for _, p := range cells {
+			lo = life.Point{X: min(lo.X, p.X), Y: min(lo.Y, p.Y), Z: min(lo.Z, p.Z)}
+			hi = life.Point{X: max(hi.X, p.X), Y: max(hi.Y, p.Y), Z: max(hi.Z, p.Z)}
+		}
+		origin = lo
+		v.Size = life.Size{X: hi.X - lo.X + 1, Y: hi.Y - lo.Y + 1, Z: hi.Z - lo.Z + 1}
+	} else {
+		v.Size = life.Size{X: 1, Y: 1, Z: 1}
+	}
+
+	indices := map[color.RGBA]uint8{}
+	used := 0
+	species, multispecies := w.(life.Multispecies)
+	for _, p := range cells {
+		c := colorOf(p)
+		rgba := color.RGBA{uint8(c.X()*255.0 + 0.5), uint8(c.Y()*255.0 + 0.5), uint8(c.Z()*255.0 + 0.5), 255}
+		index, ok := indices[rgba]
+		if multispecies && rule.Species > 1 {
+			// Species are their own palette index, so importing the model brings them back
+			index = uint8(species.Species(p))
+			v.Palette[index] = rgba
+		} else if !ok {
+			if used < 255 {
+				used++
+				index = uint8(used)
+				v.Palette[index] = rgba
+			} else {
+				index = closestColor(v.Palette[1:], rgba) + 1
+			}
+			indices[rgba] = index
+		}
+		v.Voxels = append(v.Voxels, life.Voxel{Point: life.Point{X: p.X - origin.X, Y: p.Y - origin.Y, Z: p.Z - origin.Z}, Index: index})
+	}
+	return v
+}
+
+// closestColor returns the index of the color in the palette closest to c.
+func closestColor(palette []color.RGBA, c color.RGBA) uint8 {
+	best, bestDistance := 0, -1
+	for i, p := range palette {
+		dr, dg, db := int(p.R)-int(c.R), int(p.G)-int(c.G), int(p.B)-int(c.B)
+		if distance := dr*dr + dg*dg + db*db; bestDistance < 0 || distance < bestDistance {
+			best, bestDistance = i, distance
+		}
+	}
+	return uint8(best)
+}